@@ -4,7 +4,9 @@ import (
 	"dating-app-backend/internal/app"
 	"dating-app-backend/internal/auth"
 	"dating-app-backend/internal/config"
+	"dating-app-backend/internal/cursor"
 	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
 	"os"
 )
 
@@ -26,6 +28,10 @@ func main() {
 
 	// Initialise the JWT secret
 	auth.InitJWTSecret(cfg.JwtSecret)
+	// Initialise the secret used to sign pagination cursors
+	cursor.InitSecret(cfg.CursorSecret)
+	// Initialise the prior behind attractiveness scores
+	model.InitScorePrior(model.ScorePrior{Mean: cfg.ScorePriorMean, Weight: cfg.ScorePriorWeight})
 
 	log.Info("Starting application", "port", cfg.Port)
 	if err := app.Run(); err != nil {
@@ -0,0 +1,76 @@
+// Command backfill-geohashes stores the geohash cell of every DynamoDB user
+// that lacks one. The GeohashIndex only holds users with a cell, so users
+// stored before discovery used it cannot be discovered until this has run;
+// CreateUser and UpdateUser keep the cells up to date from then on.
+package main
+
+import (
+	"context"
+	"dating-app-backend/internal/config"
+	"dating-app-backend/internal/geo"
+	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/storage"
+	"flag"
+	"os"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report how many cells would change without writing them")
+	flag.Parse()
+
+	log := logger.NewLogger()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	// The SQL and memory backends index locations themselves
+	if cfg.StorageBackend != storage.BackendDynamoDB && cfg.StorageBackend != "" {
+		log.Error("Geohashes are only stored by the dynamodb backend", "backend", cfg.StorageBackend)
+		os.Exit(1)
+	}
+
+	db, err := storage.NewDynamoDB(cfg, log)
+	if err != nil {
+		log.Error("Failed to create storage", "error", err)
+		os.Exit(1)
+	}
+
+	log.Info("Backfilling geohashes", "dryRun", *dryRun)
+
+	ctx := context.Background()
+	var scanned, updated, skipped int
+	err = db.ScanUsers(ctx, func(users []model.User) error {
+		for _, user := range users {
+			scanned++
+			if user.Geohash == geo.Cell(user.Latitude, user.Longitude) {
+				continue
+			}
+			user.UpdateGeohash()
+			if *dryRun {
+				updated++
+				continue
+			}
+
+			ok, err := db.UpdateGeohash(ctx, user)
+			if err != nil {
+				return err
+			}
+			if ok {
+				updated++
+			} else {
+				// The user moved in between and already has their new cell
+				skipped++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to backfill geohashes", "error", err, "scanned", scanned, "updated", updated)
+		os.Exit(1)
+	}
+
+	log.Info("Geohashes backfilled", "scanned", scanned, "updated", updated, "skipped", skipped)
+}
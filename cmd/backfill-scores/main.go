@@ -0,0 +1,71 @@
+// Command backfill-scores recomputes the attractiveness score of every user
+// with the configured prior. Run it after changing SCORE_PRIOR_MEAN or
+// SCORE_PRIOR_WEIGHT; swipes keep the scores up to date from then on.
+package main
+
+import (
+	"context"
+	"dating-app-backend/internal/config"
+	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/storage"
+	"flag"
+	"os"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report how many scores would change without writing them")
+	flag.Parse()
+
+	log := logger.NewLogger()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	model.InitScorePrior(model.ScorePrior{Mean: cfg.ScorePriorMean, Weight: cfg.ScorePriorWeight})
+
+	db, err := storage.New(cfg, log)
+	if err != nil {
+		log.Error("Failed to create storage", "error", err)
+		os.Exit(1)
+	}
+
+	log.Info("Backfilling attractiveness scores", "priorMean", cfg.ScorePriorMean, "priorWeight", cfg.ScorePriorWeight, "dryRun", *dryRun)
+
+	ctx := context.Background()
+	var scanned, updated, skipped int
+	err = db.ScanUsers(ctx, func(users []model.User) error {
+		for _, user := range users {
+			scanned++
+			previous := user.AttractivenessScore
+			user.UpdateAttractivenessScore()
+			if user.AttractivenessScore == previous {
+				continue
+			}
+			if *dryRun {
+				updated++
+				continue
+			}
+
+			ok, err := db.UpdateAttractivenessScore(ctx, user)
+			if err != nil {
+				return err
+			}
+			if ok {
+				updated++
+			} else {
+				// A swipe landed in between and already rescored the user
+				skipped++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to backfill attractiveness scores", "error", err, "scanned", scanned, "updated", updated)
+		os.Exit(1)
+	}
+
+	log.Info("Attractiveness scores backfilled", "scanned", scanned, "updated", updated, "skipped", skipped)
+}
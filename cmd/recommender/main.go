@@ -0,0 +1,62 @@
+// Command recommender rebuilds every user's recommended candidates from the
+// swipe history, for /discover?sortBy=recommended. It reads and writes
+// through the configured storage backend, so it runs against a local SQLite
+// or Postgres database as well as DynamoDB. Run it periodically, e.g. from
+// cron.
+package main
+
+import (
+	"context"
+	"dating-app-backend/internal/config"
+	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/recommend"
+	"dating-app-backend/internal/storage"
+	"flag"
+	"os"
+)
+
+func main() {
+	limit := flag.Int("limit", 100, "maximum number of candidates stored per user")
+	flag.Parse()
+
+	log := logger.NewLogger()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	db, err := storage.New(cfg, log)
+	if err != nil {
+		log.Error("Failed to create storage", "error", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	builder := recommend.NewBuilder()
+	var scanned int
+	err = db.ScanSwipes(ctx, func(swipes []model.Swipe) error {
+		scanned += len(swipes)
+		builder.Add(swipes)
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to scan swipes", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Swipes loaded", "swipes", scanned)
+
+	var users, candidates int
+	for _, userID := range builder.Swipers() {
+		recommendations := builder.Recommend(userID, *limit)
+		if err := db.PutRecommendations(ctx, userID, recommendations); err != nil {
+			log.Error("Failed to store recommendations", "error", err, "userId", userID)
+			os.Exit(1)
+		}
+		users++
+		candidates += len(recommendations)
+	}
+
+	log.Info("Recommendations rebuilt", "users", users, "candidates", candidates)
+}
@@ -12,6 +12,9 @@ require (
 	github.com/gofiber/contrib/jwt v1.0.10
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/jftuga/geodist v1.0.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/mmcloughlin/geohash v0.10.0
 	github.com/oklog/ulid/v2 v2.1.0
 )
 
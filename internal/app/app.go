@@ -2,32 +2,59 @@ package app
 
 import (
 	"dating-app-backend/internal/config"
+	"dating-app-backend/internal/experiment"
 	"dating-app-backend/internal/handler"
 	"dating-app-backend/internal/logger"
 	"dating-app-backend/internal/middleware"
+	"dating-app-backend/internal/ranking"
 	"dating-app-backend/internal/storage"
+	"errors"
+	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type App struct {
-	config  *config.Config
-	storage *storage.DynamoDB
-	fiber   *fiber.App
-	logger  *logger.Logger
+	config        *config.Config
+	storage       storage.Storage
+	defaultRanker ranking.Ranker
+	experiments   *experiment.Registry
+	fiber         *fiber.App
+	logger        *logger.Logger
 }
 
 func New(cfg *config.Config, logger *logger.Logger) (*App, error) {
-	db, err := storage.NewDynamoDB(cfg, logger)
+	defaultRanker, ok := ranking.Get(cfg.DefaultRanker)
+	if !ok {
+		return nil, fmt.Errorf("unknown DEFAULT_RANKER %q", cfg.DefaultRanker)
+	}
+
+	// Cursors are signed with a key of their own, so one leaking cannot be
+	// used to forge tokens
+	if cfg.CursorSecret == "" {
+		return nil, errors.New("CURSOR_SECRET must be set")
+	}
+	if cfg.CursorSecret == cfg.JwtSecret {
+		return nil, errors.New("CURSOR_SECRET must differ from JWT_SECRET")
+	}
+
+	experiments, err := experiment.Parse(cfg.Experiments)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := storage.New(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
 
 	app := &App{
-		config:  cfg,
-		storage: db,
-		fiber:   fiber.New(),
-		logger:  logger,
+		config:        cfg,
+		storage:       db,
+		defaultRanker: defaultRanker,
+		experiments:   experiments,
+		fiber:         fiber.New(),
+		logger:        logger,
 	}
 
 	app.setupRoutes()
@@ -37,9 +64,13 @@ func New(cfg *config.Config, logger *logger.Logger) (*App, error) {
 
 func (a *App) setupRoutes() {
 	userHandler := handler.NewUserHandler(a.storage, a.logger)
-	authHandler := handler.NewAuthHandler(a.storage, a.logger)
-	discoverHandler := handler.NewDiscoverHandler(a.storage, a.logger)
-	swipeHandler := handler.NewSwipeHandler(a.storage, a.logger)
+	authHandler := handler.NewAuthHandler(a.storage, a.config.DebugUserIDs, a.logger)
+	discoverHandler := handler.NewDiscoverHandler(a.storage, a.storage, a.storage, a.storage, a.defaultRanker, a.experiments, a.config.DiversityWeight, a.logger)
+	swipeHandler := handler.NewSwipeHandler(a.storage, a.storage, a.storage, a.experiments, a.logger)
+	preferencesHandler := handler.NewPreferencesHandler(a.storage, a.logger)
+	picksHandler := handler.NewPicksHandler(a.storage, a.storage, a.storage, a.logger)
+	matchesHandler := handler.NewMatchesHandler(a.storage, a.storage, a.logger)
+	superLikesHandler := handler.NewSuperLikesHandler(a.storage, a.storage, a.logger)
 
 	authMiddleware := middleware.NewAuthMiddleware(a.config)
 
@@ -49,6 +80,16 @@ func (a *App) setupRoutes() {
 	// Protected routes
 	a.fiber.Get("/discover", authMiddleware, discoverHandler.DiscoverUsers)
 	a.fiber.Post("/swipe", authMiddleware, swipeHandler.RecordSwipe)
+	a.fiber.Get("/picks", authMiddleware, picksHandler.GetPicks)
+	a.fiber.Get("/matches", authMiddleware, matchesHandler.ListMatches)
+	a.fiber.Post("/matches/:id/read", authMiddleware, matchesHandler.MarkMatchRead)
+	a.fiber.Delete("/matches/:id", authMiddleware, matchesHandler.EndMatch)
+	a.fiber.Get("/me/preferences", authMiddleware, preferencesHandler.GetPreferences)
+	a.fiber.Put("/me/preferences", authMiddleware, preferencesHandler.UpdatePreferences)
+	a.fiber.Get("/me/super-likes", authMiddleware, superLikesHandler.ListSuperLikes)
+	a.fiber.Post("/me/super-likes/read", authMiddleware, superLikesHandler.MarkSuperLikesRead)
+	a.fiber.Post("/me/deactivate", authMiddleware, userHandler.Deactivate)
+	a.fiber.Post("/me/reactivate", authMiddleware, userHandler.Reactivate)
 
 	a.logger.Info("Routes set up successfully")
 }
@@ -12,6 +12,8 @@ var jwtKey []byte
 
 type Claims struct {
 	UserID string `json:"user_id"`
+	// Debug marks tokens allowed to request diagnostics.
+	Debug bool `json:"debug,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -19,7 +21,7 @@ func InitJWTSecret(secret string) {
 	jwtKey = []byte(secret)
 }
 
-func GenerateToken(userID string) (string, error) {
+func GenerateToken(userID string, debug bool) (string, error) {
 	if len(jwtKey) == 0 {
 		return "", errors.New("JWT secret not initialized")
 	}
@@ -27,6 +29,7 @@ func GenerateToken(userID string) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &Claims{
 		UserID: userID,
+		Debug:  debug,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
@@ -54,3 +57,18 @@ func GetUserIDFromToken(c *fiber.Ctx) (string, error) {
 
 	return userID, nil
 }
+
+// IsDebugToken reports whether the request's token is a debug token.
+func IsDebugToken(c *fiber.Ctx) bool {
+	user, ok := c.Locals("user").(*jwt.Token)
+	if !ok || user == nil {
+		return false
+	}
+
+	claims, ok := user.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	debug, _ := claims["debug"].(bool)
+	return debug
+}
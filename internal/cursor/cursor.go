@@ -0,0 +1,69 @@
+package cursor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var secret []byte
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func InitSecret(s string) {
+	secret = []byte(s)
+}
+
+// Encode serialises v into an opaque token signed with the cursor secret.
+func Encode(v any) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("cursor secret not initialized")
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sign(payload)), nil
+}
+
+// Decode verifies a token produced by Encode and unmarshals it into v. Any
+// tampering or malformed input yields ErrInvalidCursor.
+func Decode(token string, v any) error {
+	if len(secret) == 0 {
+		return errors.New("cursor secret not initialized")
+	}
+
+	encodedPayload, encodedMac, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMac)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	if !hmac.Equal(mac, sign(payload)) {
+		return ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+func sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,114 @@
+// Package experiment runs A/B experiments on discovery ranking in-process.
+// Users are bucketed into arms deterministically from their ID, so a user
+// stays in the same arm across requests and restarts.
+package experiment
+
+import (
+	"dating-app-backend/internal/ranking"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+// Arm is one variant of an experiment.
+type Arm struct {
+	Name string `json:"name"`
+	// Weight is the arm's share of users, relative to the other arms.
+	Weight int `json:"weight"`
+	// Ranker names the ranker discovery uses for users in this arm when
+	// they do not pass sortBy. Empty keeps the default ranker.
+	Ranker string `json:"ranker,omitempty"`
+}
+
+type Experiment struct {
+	Name string `json:"name"`
+	Arms []Arm  `json:"arms"`
+}
+
+// Assign returns the arm userID is bucketed into. Salting the hash with the
+// experiment name keeps the arms of different experiments independent.
+func (e Experiment) Assign(userID string) Arm {
+	total := 0
+	for _, arm := range e.Arms {
+		total += arm.Weight
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(e.Name + "/" + userID))
+	bucket := int(h.Sum64() % uint64(total))
+	for _, arm := range e.Arms {
+		if bucket < arm.Weight {
+			return arm
+		}
+		bucket -= arm.Weight
+	}
+	return e.Arms[len(e.Arms)-1]
+}
+
+// Registry holds the running experiments, in priority order.
+type Registry struct {
+	experiments []Experiment
+}
+
+// Parse reads a registry from its JSON configuration, a list of experiments.
+// An empty string is an empty registry.
+func Parse(config string) (*Registry, error) {
+	registry := &Registry{}
+	if config == "" {
+		return registry, nil
+	}
+	if err := json.Unmarshal([]byte(config), &registry.experiments); err != nil {
+		return nil, fmt.Errorf("invalid experiments: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for _, e := range registry.experiments {
+		if e.Name == "" {
+			return nil, errors.New("invalid experiments: experiment without a name")
+		}
+		if names[e.Name] {
+			return nil, fmt.Errorf("invalid experiments: duplicate experiment %q", e.Name)
+		}
+		names[e.Name] = true
+
+		if len(e.Arms) == 0 {
+			return nil, fmt.Errorf("invalid experiments: %q has no arms", e.Name)
+		}
+		arms := make(map[string]bool)
+		for _, arm := range e.Arms {
+			if arm.Name == "" || arms[arm.Name] {
+				return nil, fmt.Errorf("invalid experiments: %q has a missing or duplicate arm name", e.Name)
+			}
+			arms[arm.Name] = true
+			if arm.Weight <= 0 {
+				return nil, fmt.Errorf("invalid experiments: arm %q of %q needs a positive weight", arm.Name, e.Name)
+			}
+			if _, ok := ranking.Get(arm.Ranker); arm.Ranker != "" && !ok {
+				return nil, fmt.Errorf("invalid experiments: arm %q of %q uses unknown ranker %q", arm.Name, e.Name, arm.Ranker)
+			}
+		}
+	}
+	return registry, nil
+}
+
+// Arms returns the arm userID is in for every experiment, keyed by
+// experiment name.
+func (r *Registry) Arms(userID string) map[string]string {
+	arms := make(map[string]string, len(r.experiments))
+	for _, e := range r.experiments {
+		arms[e.Name] = e.Assign(userID).Name
+	}
+	return arms
+}
+
+// Ranker returns the ranker userID's arms select. The first experiment
+// whose arm names a ranker wins. ok is false if none does.
+func (r *Registry) Ranker(userID string) (ranker ranking.Ranker, ok bool) {
+	for _, e := range r.experiments {
+		if arm := e.Assign(userID); arm.Ranker != "" {
+			return ranking.Get(arm.Ranker)
+		}
+	}
+	return nil, false
+}
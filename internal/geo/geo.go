@@ -0,0 +1,119 @@
+package geo
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jftuga/geodist"
+	"github.com/mmcloughlin/geohash"
+)
+
+// CellPrecision is the geohash length used to bucket users for discovery. A
+// 4 character cell is roughly 39km x 20km at the equator.
+const CellPrecision = 4
+
+// EarthRadiusKm matches the radius geodist uses.
+const EarthRadiusKm = 6378.1
+
+// KmPerMile converts miles to kilometres.
+const KmPerMile = 1.609344
+
+const kmPerDegree = EarthRadiusKm * math.Pi / 180
+
+// Cell returns the geohash cell of the given point at CellPrecision.
+func Cell(lat, lon float64) string {
+	return geohash.EncodeWithPrecision(lat, lon, CellPrecision)
+}
+
+// DistanceKm returns the great-circle distance between two points.
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	_, km := geodist.HaversineDistance(geodist.Coord{Lat: lat1, Lon: lon1}, geodist.Coord{Lat: lat2, Lon: lon2})
+	return km
+}
+
+// BoundingBox returns a latitude/longitude box that contains every point
+// within radiusKm of (lat, lon). Near the poles or the antimeridian it falls
+// back to the full longitude range rather than wrapping.
+func BoundingBox(lat, lon, radiusKm float64) (minLat, maxLat, minLon, maxLon float64) {
+	dLat := radiusKm / kmPerDegree
+	minLat, maxLat = lat-dLat, lat+dLat
+	if minLat <= -90 || maxLat >= 90 {
+		return max(minLat, -90), min(maxLat, 90), -180, 180
+	}
+
+	dLon := dLat / math.Cos(lat*math.Pi/180)
+	minLon, maxLon = lon-dLon, lon+dLon
+	if minLon < -180 || maxLon > 180 {
+		return minLat, maxLat, -180, 180
+	}
+	return minLat, maxLat, minLon, maxLon
+}
+
+// NearbyCell is a cell together with a lower bound on the distance from the
+// search point to anything inside it.
+type NearbyCell struct {
+	Cell          string
+	MinDistanceKm float64
+}
+
+// CellsWithin returns every cell that may hold a point within radiusKm of
+// (lat, lon), nearest first. Querying the cells in order and stopping once
+// MinDistanceKm exceeds the furthest result needed yields the nearest points.
+func CellsWithin(lat, lon, radiusKm float64) []NearbyCell {
+	box := geohash.BoundingBox(Cell(lat, lon))
+	cellLat := box.MaxLat - box.MinLat
+	cellLon := box.MaxLng - box.MinLng
+	rows := int(math.Round(180 / cellLat))
+	cols := int(math.Round(360 / cellLon))
+
+	minLat, maxLat, minLon, maxLon := BoundingBox(lat, lon, radiusKm)
+	firstRow, lastRow := gridIndex(minLat+90, cellLat, rows), gridIndex(maxLat+90, cellLat, rows)
+	firstCol, lastCol := gridIndex(minLon+180, cellLon, cols), gridIndex(maxLon+180, cellLon, cols)
+
+	var cells []NearbyCell
+	for row := firstRow; row <= lastRow; row++ {
+		for col := firstCol; col <= lastCol; col++ {
+			cell := Cell(-90+(float64(row)+0.5)*cellLat, -180+(float64(col)+0.5)*cellLon)
+			distance := minDistanceKm(lat, lon, geohash.BoundingBox(cell))
+			if distance <= radiusKm {
+				cells = append(cells, NearbyCell{Cell: cell, MinDistanceKm: distance})
+			}
+		}
+	}
+
+	sort.Slice(cells, func(i, j int) bool {
+		return cells[i].MinDistanceKm < cells[j].MinDistanceKm
+	})
+	return cells
+}
+
+func gridIndex(offset, size float64, count int) int {
+	return min(max(int(offset/size), 0), count-1)
+}
+
+// minDistanceKm returns the distance from (lat, lon) to the nearest point of
+// box.
+func minDistanceKm(lat, lon float64, box geohash.Box) float64 {
+	if lon >= box.MinLng && lon <= box.MaxLng {
+		return DistanceKm(lat, lon, clamp(lat, box.MinLat, box.MaxLat), lon)
+	}
+	return min(edgeDistanceKm(lat, lon, box.MinLng, box.MinLat, box.MaxLat),
+		edgeDistanceKm(lat, lon, box.MaxLng, box.MinLat, box.MaxLat))
+}
+
+// edgeDistanceKm returns the distance from (lat, lon) to the meridian segment
+// at edgeLon between minLat and maxLat.
+func edgeDistanceKm(lat, lon, edgeLon, minLat, maxLat float64) float64 {
+	const rad = math.Pi / 180
+	// The closest point on the whole meridian; distance grows monotonically
+	// away from it, so clamping to the segment gives the closest point there.
+	nearest := math.Copysign(90, lat)
+	if c := math.Cos((lon - edgeLon) * rad); c > 0 {
+		nearest = math.Atan(math.Tan(lat*rad)/c) / rad
+	}
+	return DistanceKm(lat, lon, clamp(nearest, minLat, maxLat), edgeLon)
+}
+
+func clamp(x, lo, hi float64) float64 {
+	return min(max(x, lo), hi)
+}
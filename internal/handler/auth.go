@@ -4,17 +4,21 @@ import (
 	"dating-app-backend/internal/auth"
 	"dating-app-backend/internal/logger"
 	"dating-app-backend/internal/storage"
+	"slices"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+var errInvalidCredentials = &apiError{fiber.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid credentials"}
+
 type AuthHandler struct {
-	storage *storage.DynamoDB
-	logger  *logger.Logger
+	storage      storage.UserRepository
+	debugUserIDs []string
+	logger       *logger.Logger
 }
 
-func NewAuthHandler(storage *storage.DynamoDB, logger *logger.Logger) *AuthHandler {
-	return &AuthHandler{storage: storage, logger: logger}
+func NewAuthHandler(storage storage.UserRepository, debugUserIDs []string, logger *logger.Logger) *AuthHandler {
+	return &AuthHandler{storage: storage, debugUserIDs: debugUserIDs, logger: logger}
 }
 
 func (h *AuthHandler) Login(ctx *fiber.Ctx) error {
@@ -25,24 +29,24 @@ func (h *AuthHandler) Login(ctx *fiber.Ctx) error {
 
 	if err := ctx.BodyParser(&input); err != nil {
 		h.logger.Error("Failed to parse login input", "error", err)
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		return sendError(ctx, errInvalidInput)
 	}
 
 	user, err := h.storage.GetUserByEmail(ctx.Context(), input.Email)
 	if err != nil {
 		h.logger.Error("Failed to get user by email", "error", err, "email", input.Email)
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+		return sendError(ctx, errInvalidCredentials)
 	}
 
 	if !user.CheckPassword(input.Password) {
 		h.logger.Warn("Invalid password attempt", "email", input.Email)
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+		return sendError(ctx, errInvalidCredentials)
 	}
 
-	token, err := auth.GenerateToken(user.ID)
+	token, err := auth.GenerateToken(user.ID, slices.Contains(h.debugUserIDs, user.ID))
 	if err != nil {
 		h.logger.Error("Failed to generate token", "error", err, "userId", user.ID)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+		return sendError(ctx, errInternal.withMessage("Failed to generate token"))
 	}
 
 	h.logger.Info("User logged in successfully", "userId", user.ID)
@@ -2,48 +2,269 @@ package handler
 
 import (
 	"dating-app-backend/internal/auth"
+	"dating-app-backend/internal/cursor"
+	"dating-app-backend/internal/experiment"
+	"dating-app-backend/internal/geo"
 	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/ranking"
 	"dating-app-backend/internal/storage"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+const (
+	defaultDiscoverLimit = 10
+	maxDiscoverLimit     = 50
+)
+
+var (
+	errDebugTokenRequired = &apiError{fiber.StatusForbidden, "DEBUG_TOKEN_REQUIRED", "explain requires a debug token"}
+	errCursorOutdated     = &apiError{fiber.StatusConflict, "CURSOR_OUTDATED", "Results have changed, start again without a cursor"}
+)
+
+// explainedResult is a discovery result with the breakdown of its score,
+// returned with explain=true.
+type explainedResult struct {
+	model.UserPublicData
+	Explain ranking.Explanation `json:"explain"`
+}
+
+// discoverCursor is the payload of the signed /discover cursor. It is bound
+// to the user and the filters it was issued for, and to the caller's
+// ranking inputs as of the first page.
+type discoverCursor struct {
+	UserID string           `json:"u"`
+	Query  string           `json:"q"`
+	Inputs string           `json:"i"`
+	AsOf   time.Time        `json:"t"`
+	After  storage.Position `json:"a"`
+}
+
 type DiscoverHandler struct {
-	storage *storage.DynamoDB
-	logger  *logger.Logger
+	users           storage.UserRepository
+	discovery       storage.DiscoveryRepository
+	recommendations storage.RecommendationRepository
+	superLikes      storage.SuperLikeRepository
+	defaultRanker   ranking.Ranker
+	experiments     *experiment.Registry
+	diversityWeight float64
+	logger          *logger.Logger
 }
 
-func NewDiscoverHandler(storage *storage.DynamoDB, logger *logger.Logger) *DiscoverHandler {
-	return &DiscoverHandler{storage: storage, logger: logger}
+func NewDiscoverHandler(users storage.UserRepository, discovery storage.DiscoveryRepository, recommendations storage.RecommendationRepository, superLikes storage.SuperLikeRepository, defaultRanker ranking.Ranker, experiments *experiment.Registry, diversityWeight float64, logger *logger.Logger) *DiscoverHandler {
+	return &DiscoverHandler{users: users, discovery: discovery, recommendations: recommendations, superLikes: superLikes, defaultRanker: defaultRanker, experiments: experiments, diversityWeight: diversityWeight, logger: logger}
 }
 
 func (h *DiscoverHandler) DiscoverUsers(ctx *fiber.Ctx) error {
 	userID, err := auth.GetUserIDFromToken(ctx)
 	if err != nil {
 		h.logger.Error("Failed to get user ID from token", "error", err)
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		return sendError(ctx, errInvalidToken)
 	}
 
-	currentUser, err := h.storage.GetUserByID(ctx.Context(), userID)
+	currentUser, err := h.users.GetUserByID(ctx.Context(), userID)
 	if err != nil {
 		h.logger.Error("Failed to get current user", "error", err, "userID", userID)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get current user"})
+		return sendError(ctx, errInternal.withMessage("Failed to get current user"))
+	}
+
+	// An explicit sortBy wins over the ranker of the user's experiment arm
+	ranker := h.defaultRanker
+	if armRanker, ok := h.experiments.Ranker(userID); ok {
+		ranker = armRanker
+	}
+	if sortBy := ctx.Query("sortBy"); sortBy != "" {
+		var ok bool
+		if ranker, ok = ranking.Get(sortBy); !ok {
+			h.logger.Warn("Unknown sortBy", "sortBy", sortBy, "userID", userID)
+			return sendError(ctx, errInvalidParameter.withMessage("sortBy must be one of "+strings.Join(ranking.Names(), ", ")))
+		}
+	}
+
+	maxDistanceKm, err := parseMaxDistanceKm(ctx.Query("maxDistanceKm"), ctx.Query("unit", "km"))
+	if err != nil {
+		h.logger.Warn("Invalid max distance", "error", err, "userID", userID)
+		return sendError(ctx, errInvalidParameter.withMessage(err.Error()))
+	}
+
+	explain := ctx.QueryBool("explain")
+	if explain && !auth.IsDebugToken(ctx) {
+		h.logger.Warn("Explain requested without a debug token", "userID", userID)
+		return sendError(ctx, errDebugTokenRequired)
+	}
+
+	limit, err := parseLimit(ctx.Query("limit"))
+	if err != nil {
+		h.logger.Warn("Invalid limit", "error", err, "userID", userID)
+		return sendError(ctx, errInvalidParameter.withMessage(err.Error()))
+	}
+
+	// Stored preferences apply unless the request overrides them
+	prefs := currentUser.Preferences
+	opts := storage.DiscoverOptions{
+		Limit:         limit,
+		MinAge:        prefs.MinAge,
+		MaxAge:        prefs.MaxAge,
+		Genders:       prefs.Genders,
+		Ranker:        ranker,
+		MaxDistanceKm: prefs.MaxDistanceKm,
+		Diversity:     h.diversityWeight,
+	}
+	if value := ctx.Query("minAge"); value != "" {
+		opts.MinAge, _ = strconv.Atoi(value)
+	}
+	if value := ctx.Query("maxAge"); value != "" {
+		opts.MaxAge, _ = strconv.Atoi(value)
+	}
+	if gender := ctx.Query("gender"); gender != "" {
+		opts.Genders = []string{gender}
+	}
+	if maxDistanceKm > 0 {
+		opts.MaxDistanceKm = maxDistanceKm
+	}
+
+	if _, ok := ranker.(ranking.RecommendationRanker); ok {
+		opts.Recommendations, err = h.recommendations.GetRecommendations(ctx.Context(), userID)
+		if err != nil {
+			h.logger.Error("Failed to get recommendations", "error", err, "userID", userID)
+			return sendError(ctx, errInternal.withMessage("Failed to discover users"))
+		}
+	}
+
+	// Following pages rank with the inputs of the first one
+	c := discoverCursor{UserID: userID, Query: queryFingerprint(opts), AsOf: time.Now().UTC()}
+	if token := ctx.Query("cursor"); token != "" {
+		var after discoverCursor
+		if err := cursor.Decode(token, &after); err != nil || after.UserID != userID || after.Query != c.Query {
+			h.logger.Warn("Invalid discover cursor", "error", err, "userID", userID)
+			return sendError(ctx, errInvalidCursor)
+		}
+		c = after
+		opts.After = &c.After
+	}
+
+	// Users who super-liked the caller are shown first and flagged
+	superLikes, err := h.superLikes.ListSuperLikes(ctx.Context(), userID, storage.ListSuperLikesOptions{})
+	if err != nil {
+		h.logger.Error("Failed to get super-likes", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to discover users"))
+	}
+	opts.SuperLikedBy = make(map[string]bool, len(superLikes))
+	for _, superLike := range superLikes {
+		if !superLike.CreatedAt.After(c.AsOf) {
+			opts.SuperLikedBy[superLike.SwiperId] = true
+		}
 	}
 
-	minAge, _ := strconv.Atoi(ctx.Query("minAge", "0"))
-	maxAge, _ := strconv.Atoi(ctx.Query("maxAge", "0"))
-	gender := ctx.Query("gender", "")
-	sortBy := ctx.Query("sortBy", "combined") // Default to combined sorting
+	// Pages ranked with different inputs could repeat or skip candidates
+	if opts.After == nil {
+		c.Inputs = inputsFingerprint(opts)
+	} else if c.Inputs != inputsFingerprint(opts) {
+		h.logger.Warn("Discover cursor is out of date", "userID", userID)
+		return sendError(ctx, errCursorOutdated)
+	}
 
-	h.logger.Info("Discovering users", "userID", userID, "minAge", minAge, "maxAge", maxAge, "gender", gender, "sortBy", sortBy)
-	// TODO: Implement pagination
-	discoveredUsers, err := h.storage.DiscoverUsers(ctx.Context(), *currentUser, 10, minAge, maxAge, gender, sortBy)
+	h.logger.Info("Discovering users", "userID", userID, "minAge", opts.MinAge, "maxAge", opts.MaxAge, "genders", opts.Genders, "sortBy", ranker.Name(), "maxDistanceKm", opts.MaxDistanceKm, "limit", limit, "arms", h.experiments.Arms(userID))
+	page, err := h.discovery.DiscoverUsers(ctx.Context(), *currentUser, opts)
+	if errors.Is(err, storage.ErrRankingExpired) {
+		h.logger.Warn("Discover cursor has expired", "userID", userID)
+		return sendError(ctx, errCursorOutdated)
+	}
 	if err != nil {
 		h.logger.Error("Failed to discover users", "error", err, "userID", userID)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to discover users"})
+		return sendError(ctx, errInternal.withMessage("Failed to discover users"))
+	}
+
+	response := fiber.Map{"results": page.Results}
+	if explain {
+		results := make([]explainedResult, len(page.Results))
+		for i, result := range page.Results {
+			results[i] = explainedResult{UserPublicData: result, Explain: ranking.Explain(ranker, result)}
+		}
+		response["results"] = results
+	}
+	if page.Next != nil {
+		c.After = *page.Next
+		nextCursor, err := cursor.Encode(c)
+		if err != nil {
+			h.logger.Error("Failed to encode discover cursor", "error", err, "userID", userID)
+			return sendError(ctx, errInternal.withMessage("Failed to discover users"))
+		}
+		response["nextCursor"] = nextCursor
+	}
+
+	h.logger.Info("Users discovered successfully", "userID", userID, "count", len(page.Results))
+	return ctx.JSON(response)
+}
+
+// parseMaxDistanceKm reads the maxDistanceKm query parameter, which is given
+// in unit ("km" or "mi"), and returns it in kilometres. Zero means no limit.
+func parseMaxDistanceKm(value, unit string) (float64, error) {
+	var factor float64
+	switch unit {
+	case "km":
+		factor = 1
+	case "mi":
+		factor = geo.KmPerMile
+	default:
+		return 0, errors.New("unit must be km or mi")
+	}
+
+	if value == "" {
+		return 0, nil
+	}
+
+	distance, err := strconv.ParseFloat(value, 64)
+	if err != nil || distance <= 0 {
+		return 0, errors.New("maxDistanceKm must be a positive number")
+	}
+
+	return distance * factor, nil
+}
+
+// parseLimit reads the limit query parameter, capping it at maxDiscoverLimit.
+func parseLimit(value string) (int32, error) {
+	if value == "" {
+		return defaultDiscoverLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("limit must be a positive integer")
 	}
 
-	h.logger.Info("Users discovered successfully", "userID", userID, "count", len(discoveredUsers))
-	return ctx.JSON(fiber.Map{"results": discoveredUsers})
+	return int32(min(limit, maxDiscoverLimit)), nil
+}
+
+// queryFingerprint identifies the filters and ordering of a discovery
+// request, so a cursor cannot be replayed against a different query.
+func queryFingerprint(opts storage.DiscoverOptions) string {
+	return fmt.Sprintf("%d|%d|%s|%s|%g|%g", opts.MinAge, opts.MaxAge, strings.Join(opts.Genders, ","), opts.Ranker.Name(), opts.MaxDistanceKm, opts.Diversity)
+}
+
+// inputsFingerprint identifies the ranking inputs that are particular to
+// the caller, so a cursor is not used once they have changed.
+func inputsFingerprint(opts storage.DiscoverOptions) string {
+	inputs := make([]string, 0, len(opts.Recommendations)+len(opts.SuperLikedBy))
+	for id, score := range opts.Recommendations {
+		inputs = append(inputs, fmt.Sprintf("r%s=%g", id, score))
+	}
+	for id := range opts.SuperLikedBy {
+		inputs = append(inputs, "s"+id)
+	}
+	slices.Sort(inputs)
+
+	hash := fnv.New64a()
+	for _, input := range inputs {
+		hash.Write([]byte(input + "|"))
+	}
+	return strconv.FormatUint(hash.Sum64(), 36)
 }
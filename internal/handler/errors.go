@@ -0,0 +1,32 @@
+package handler
+
+import "github.com/gofiber/fiber/v2"
+
+// apiError is a refused request. Every error the handlers send is one of
+// these, so clients always get the same envelope: a message under "error"
+// and a stable code under "code" to branch on.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+// withMessage returns err with a message about the particular request.
+func (err *apiError) withMessage(message string) *apiError {
+	return &apiError{status: err.status, code: err.code, message: message}
+}
+
+// Errors shared by several endpoints. Internal errors carry the message of
+// the endpoint that failed, via withMessage.
+var (
+	errInvalidToken     = &apiError{fiber.StatusUnauthorized, "INVALID_TOKEN", "Invalid token"}
+	errInvalidInput     = &apiError{fiber.StatusBadRequest, "INVALID_INPUT", "Invalid input"}
+	errInvalidParameter = &apiError{fiber.StatusBadRequest, "INVALID_PARAMETER", "Invalid parameter"}
+	errInvalidCursor    = &apiError{fiber.StatusBadRequest, "INVALID_CURSOR", "Invalid cursor"}
+	errInternal         = &apiError{fiber.StatusInternalServerError, "INTERNAL", "Internal error"}
+)
+
+// sendError writes err in the error envelope.
+func sendError(c *fiber.Ctx, err *apiError) error {
+	return c.Status(err.status).JSON(fiber.Map{"error": err.message, "code": err.code})
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"dating-app-backend/internal/auth"
+	"dating-app-backend/internal/cursor"
+	"dating-app-backend/internal/geo"
+	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/storage"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errMatchNotFound = &apiError{fiber.StatusNotFound, "MATCH_NOT_FOUND", "Match not found"}
+
+// matchResult is a match as returned to one of its users, with the other
+// user's public profile.
+type matchResult struct {
+	ID        string               `json:"id"`
+	CreatedAt time.Time            `json:"createdAt"`
+	Status    model.MatchStatus    `json:"status"`
+	Unread    bool                 `json:"unread"`
+	User      model.UserPublicData `json:"user"`
+}
+
+// matchesCursor is the payload of the signed /matches cursor. It is bound to
+// the user and the filters it was issued for.
+type matchesCursor struct {
+	UserID string `json:"u"`
+	Query  string `json:"q"`
+	Before string `json:"b"`
+}
+
+type MatchesHandler struct {
+	users   storage.UserRepository
+	matches storage.MatchRepository
+	logger  *logger.Logger
+}
+
+func NewMatchesHandler(users storage.UserRepository, matches storage.MatchRepository, logger *logger.Logger) *MatchesHandler {
+	return &MatchesHandler{users: users, matches: matches, logger: logger}
+}
+
+// ListMatches returns the caller's matches, newest first.
+func (h *MatchesHandler) ListMatches(ctx *fiber.Ctx) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	currentUser, err := h.users.GetUserByID(ctx.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get current user", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to get current user"))
+	}
+
+	limit, err := parseLimit(ctx.Query("limit"))
+	if err != nil {
+		h.logger.Warn("Invalid limit", "error", err, "userID", userID)
+		return sendError(ctx, errInvalidParameter.withMessage(err.Error()))
+	}
+
+	opts := storage.ListMatchesOptions{
+		Limit:      limit,
+		UnreadOnly: ctx.QueryBool("unreadOnly"),
+	}
+
+	query := strconv.FormatBool(opts.UnreadOnly)
+	if token := ctx.Query("cursor"); token != "" {
+		var c matchesCursor
+		if err := cursor.Decode(token, &c); err != nil || c.UserID != userID || c.Query != query {
+			h.logger.Warn("Invalid matches cursor", "error", err, "userID", userID)
+			return sendError(ctx, errInvalidCursor)
+		}
+		opts.Before = c.Before
+	}
+
+	h.logger.Info("Listing matches", "userID", userID, "unreadOnly", opts.UnreadOnly, "limit", limit)
+	page, err := h.matches.ListMatches(ctx.Context(), userID, opts)
+	if err != nil {
+		h.logger.Error("Failed to list matches", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to list matches"))
+	}
+
+	results := make([]matchResult, 0, len(page.Matches))
+	for _, match := range page.Matches {
+		otherUser, err := h.users.GetUserByID(ctx.Context(), match.OtherUserId(userID))
+		if errors.Is(err, storage.ErrUserNotFound) {
+			h.logger.Warn("Skipping match with missing user", "userID", userID, "matchId", match.ID)
+			continue
+		}
+		if err != nil {
+			h.logger.Error("Failed to get matched user", "error", err, "userID", userID, "matchId", match.ID)
+			return sendError(ctx, errInternal.withMessage("Failed to list matches"))
+		}
+
+		user := otherUser.PublicData()
+		user.DistanceFromMe = geo.DistanceKm(currentUser.Latitude, currentUser.Longitude, otherUser.Latitude, otherUser.Longitude) / geo.KmPerMile
+		results = append(results, matchResult{
+			ID:        match.ID,
+			CreatedAt: match.CreatedAt,
+			Status:    match.Status,
+			Unread:    match.Unread,
+			User:      user,
+		})
+	}
+
+	response := fiber.Map{"results": results}
+	if page.Next != "" {
+		nextCursor, err := cursor.Encode(matchesCursor{UserID: userID, Query: query, Before: page.Next})
+		if err != nil {
+			h.logger.Error("Failed to encode matches cursor", "error", err, "userID", userID)
+			return sendError(ctx, errInternal.withMessage("Failed to list matches"))
+		}
+		response["nextCursor"] = nextCursor
+	}
+
+	h.logger.Info("Matches listed successfully", "userID", userID, "count", len(results))
+	return ctx.JSON(response)
+}
+
+// MarkMatchRead clears the unread flag on one of the caller's matches.
+func (h *MatchesHandler) MarkMatchRead(ctx *fiber.Ctx) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	matchID := ctx.Params("id")
+	err = h.matches.MarkMatchRead(ctx.Context(), userID, matchID)
+	if errors.Is(err, storage.ErrMatchNotFound) {
+		return sendError(ctx, errMatchNotFound)
+	}
+	if err != nil {
+		h.logger.Error("Failed to mark match read", "error", err, "userID", userID, "matchId", matchID)
+		return sendError(ctx, errInternal.withMessage("Failed to mark match read"))
+	}
+
+	h.logger.Info("Match marked read", "userID", userID, "matchId", matchID)
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// EndMatch unmatches the caller from one of their matches. The pair's swipes
+// are kept, so neither user is shown the other in discovery again.
+func (h *MatchesHandler) EndMatch(ctx *fiber.Ctx) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	matchID := ctx.Params("id")
+	err = h.matches.EndMatch(ctx.Context(), userID, matchID)
+	if errors.Is(err, storage.ErrMatchNotFound) {
+		return sendError(ctx, errMatchNotFound)
+	}
+	if err != nil {
+		h.logger.Error("Failed to end match", "error", err, "userID", userID, "matchId", matchID)
+		return sendError(ctx, errInternal.withMessage("Failed to end match"))
+	}
+
+	h.logger.Info("Match ended", "userID", userID, "matchId", matchID)
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
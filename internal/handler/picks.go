@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"dating-app-backend/internal/auth"
+	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/ranking"
+	"dating-app-backend/internal/storage"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// dailyPicksCount is how many picks a user is given each day.
+const dailyPicksCount = 5
+
+type PicksHandler struct {
+	users     storage.UserRepository
+	discovery storage.DiscoveryRepository
+	picks     storage.PicksRepository
+	logger    *logger.Logger
+}
+
+func NewPicksHandler(users storage.UserRepository, discovery storage.DiscoveryRepository, picks storage.PicksRepository, logger *logger.Logger) *PicksHandler {
+	return &PicksHandler{users: users, discovery: discovery, picks: picks, logger: logger}
+}
+
+// GetPicks returns the caller's picks for the current UTC day. They are
+// chosen on the first request of the day and stay the same until the next,
+// apart from picks the caller has swiped on in the meantime.
+func (h *PicksHandler) GetPicks(ctx *fiber.Ctx) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	currentUser, err := h.users.GetUserByID(ctx.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get current user", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to get current user"))
+	}
+
+	day := time.Now().UTC().Format(time.DateOnly)
+	picks, ok, err := h.picks.GetPicks(ctx.Context(), *currentUser, day)
+	if err != nil {
+		h.logger.Error("Failed to get picks", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to get picks"))
+	}
+
+	if !ok {
+		h.logger.Info("Choosing daily picks", "userID", userID, "day", day)
+
+		// The picks are the best discovery results under the user's saved
+		// preferences, weighing attractiveness against distance.
+		prefs := currentUser.Preferences
+		page, err := h.discovery.DiscoverUsers(ctx.Context(), *currentUser, storage.DiscoverOptions{
+			Limit:         dailyPicksCount,
+			MinAge:        prefs.MinAge,
+			MaxAge:        prefs.MaxAge,
+			Genders:       prefs.Genders,
+			Ranker:        ranking.Combined{},
+			MaxDistanceKm: prefs.MaxDistanceKm,
+		})
+		if err != nil {
+			h.logger.Error("Failed to discover picks", "error", err, "userID", userID)
+			return sendError(ctx, errInternal.withMessage("Failed to get picks"))
+		}
+
+		pickIDs := make([]string, len(page.Results))
+		for i, pick := range page.Results {
+			pickIDs[i] = pick.ID
+		}
+		if err := h.picks.PutPicks(ctx.Context(), userID, day, pickIDs); err != nil {
+			h.logger.Error("Failed to store picks", "error", err, "userID", userID)
+			return sendError(ctx, errInternal.withMessage("Failed to get picks"))
+		}
+
+		// Read them back, in case a concurrent request stored its picks first
+		picks, _, err = h.picks.GetPicks(ctx.Context(), *currentUser, day)
+		if err != nil {
+			h.logger.Error("Failed to get picks", "error", err, "userID", userID)
+			return sendError(ctx, errInternal.withMessage("Failed to get picks"))
+		}
+	}
+
+	h.logger.Info("Picks retrieved successfully", "userID", userID, "day", day, "count", len(picks))
+	return ctx.JSON(fiber.Map{"day": day, "results": picks})
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"dating-app-backend/internal/auth"
+	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/storage"
+	"errors"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PreferencesHandler struct {
+	storage storage.UserRepository
+	logger  *logger.Logger
+}
+
+func NewPreferencesHandler(storage storage.UserRepository, logger *logger.Logger) *PreferencesHandler {
+	return &PreferencesHandler{storage: storage, logger: logger}
+}
+
+func (h *PreferencesHandler) GetPreferences(ctx *fiber.Ctx) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	user, err := h.storage.GetUserByID(ctx.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get current user", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to get current user"))
+	}
+
+	return ctx.JSON(fiber.Map{"result": withDefaults(user.Preferences)})
+}
+
+func (h *PreferencesHandler) UpdatePreferences(ctx *fiber.Ctx) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	var input model.DiscoveryPreferences
+	if err := ctx.BodyParser(&input); err != nil {
+		h.logger.Error("Failed to parse preferences input", "error", err)
+		return sendError(ctx, errInvalidInput)
+	}
+
+	if err := validatePreferences(input); err != nil {
+		h.logger.Warn("Invalid preferences", "error", err, "userID", userID)
+		return sendError(ctx, errInvalidInput.withMessage(err.Error()))
+	}
+
+	prefs := withDefaults(input)
+	if err := h.storage.UpdatePreferences(ctx.Context(), userID, prefs); err != nil {
+		h.logger.Error("Failed to update preferences", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to update preferences"))
+	}
+
+	h.logger.Info("Preferences updated successfully", "userID", userID)
+	return ctx.JSON(fiber.Map{"result": prefs})
+}
+
+// withDefaults fills in the fields a client may leave out.
+func withDefaults(prefs model.DiscoveryPreferences) model.DiscoveryPreferences {
+	if prefs.ShowMe == nil {
+		showMe := true
+		prefs.ShowMe = &showMe
+	}
+	if prefs.Genders == nil {
+		prefs.Genders = []string{}
+	}
+	return prefs
+}
+
+func validatePreferences(prefs model.DiscoveryPreferences) error {
+	if prefs.MinAge < 0 || prefs.MaxAge < 0 {
+		return errors.New("ages cannot be negative")
+	}
+	if prefs.MinAge > 0 && prefs.MaxAge > 0 && prefs.MinAge > prefs.MaxAge {
+		return errors.New("minAge cannot be greater than maxAge")
+	}
+	if prefs.MaxDistanceKm < 0 {
+		return errors.New("maxDistanceKm cannot be negative")
+	}
+	for _, gender := range prefs.Genders {
+		if !slices.Contains(model.Genders, gender) {
+			return errors.New("unknown gender " + gender)
+		}
+	}
+	return nil
+}
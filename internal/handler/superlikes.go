@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"dating-app-backend/internal/auth"
+	"dating-app-backend/internal/geo"
+	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/storage"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// superLikeResult is a super-like as returned to the super-liked user, with
+// the swiper's public profile.
+type superLikeResult struct {
+	CreatedAt time.Time            `json:"createdAt"`
+	Unread    bool                 `json:"unread"`
+	User      model.UserPublicData `json:"user"`
+}
+
+type SuperLikesHandler struct {
+	users      storage.UserRepository
+	superLikes storage.SuperLikeRepository
+	logger     *logger.Logger
+}
+
+func NewSuperLikesHandler(users storage.UserRepository, superLikes storage.SuperLikeRepository, logger *logger.Logger) *SuperLikesHandler {
+	return &SuperLikesHandler{users: users, superLikes: superLikes, logger: logger}
+}
+
+// ListSuperLikes returns the super-likes the caller has received, newest
+// first, so they can be told who super-liked them. The ones they have not
+// been told about yet are flagged unread.
+func (h *SuperLikesHandler) ListSuperLikes(ctx *fiber.Ctx) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	currentUser, err := h.users.GetUserByID(ctx.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get current user", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to get current user"))
+	}
+
+	opts := storage.ListSuperLikesOptions{UnreadOnly: ctx.QueryBool("unreadOnly")}
+	superLikes, err := h.superLikes.ListSuperLikes(ctx.Context(), userID, opts)
+	if err != nil {
+		h.logger.Error("Failed to list super-likes", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to list super-likes"))
+	}
+
+	results := make([]superLikeResult, 0, len(superLikes))
+	for _, superLike := range superLikes {
+		swiper, err := h.users.GetUserByID(ctx.Context(), superLike.SwiperId)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			h.logger.Warn("Skipping super-like from missing user", "userID", userID, "swiperId", superLike.SwiperId)
+			continue
+		}
+		if err != nil {
+			h.logger.Error("Failed to get swiper", "error", err, "userID", userID, "swiperId", superLike.SwiperId)
+			return sendError(ctx, errInternal.withMessage("Failed to list super-likes"))
+		}
+
+		user := swiper.PublicData()
+		user.DistanceFromMe = geo.DistanceKm(currentUser.Latitude, currentUser.Longitude, swiper.Latitude, swiper.Longitude) / geo.KmPerMile
+		user.SuperLiked = true
+		results = append(results, superLikeResult{CreatedAt: superLike.CreatedAt, Unread: superLike.Unread, User: user})
+	}
+
+	h.logger.Info("Super-likes listed successfully", "userID", userID, "unreadOnly", opts.UnreadOnly, "count", len(results))
+	return ctx.JSON(fiber.Map{"results": results})
+}
+
+// MarkSuperLikesRead clears the unread flag on every super-like the caller
+// has received.
+func (h *SuperLikesHandler) MarkSuperLikesRead(ctx *fiber.Ctx) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	if err := h.superLikes.MarkSuperLikesRead(ctx.Context(), userID); err != nil {
+		h.logger.Error("Failed to mark super-likes read", "error", err, "userID", userID)
+		return sendError(ctx, errInternal.withMessage("Failed to mark super-likes read"))
+	}
+
+	h.logger.Info("Super-likes marked read", "userID", userID)
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
@@ -2,27 +2,35 @@ package handler
 
 import (
 	"dating-app-backend/internal/auth"
+	"dating-app-backend/internal/experiment"
 	"dating-app-backend/internal/logger"
 	"dating-app-backend/internal/model"
 	"dating-app-backend/internal/storage"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
 type SwipeHandler struct {
-	storage *storage.DynamoDB
-	logger  *logger.Logger
+	users       storage.UserRepository
+	storage     storage.SwipeRepository
+	idempotency storage.IdempotencyRepository
+	experiments *experiment.Registry
+	logger      *logger.Logger
 }
 
-func NewSwipeHandler(storage *storage.DynamoDB, logger *logger.Logger) *SwipeHandler {
-	return &SwipeHandler{storage: storage, logger: logger}
+func NewSwipeHandler(users storage.UserRepository, storage storage.SwipeRepository, idempotency storage.IdempotencyRepository, experiments *experiment.Registry, logger *logger.Logger) *SwipeHandler {
+	return &SwipeHandler{users: users, storage: storage, idempotency: idempotency, experiments: experiments, logger: logger}
 }
 
 func (h *SwipeHandler) RecordSwipe(c *fiber.Ctx) error {
 	userID, err := auth.GetUserIDFromToken(c)
 	if err != nil {
 		h.logger.Error("Failed to get user ID from token", "error", err)
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		return sendError(c, errInvalidToken)
 	}
 
 	var input struct {
@@ -32,26 +40,88 @@ func (h *SwipeHandler) RecordSwipe(c *fiber.Ctx) error {
 
 	if err := c.BodyParser(&input); err != nil {
 		h.logger.Error("Failed to parse swipe input", "error", err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		return sendError(c, errInvalidInput)
 	}
 
 	swipe := model.Swipe{
 		SwiperId:   userID,
 		SwipedId:   input.SwipedId,
 		Preference: input.Preference,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	if swipeErr := validateSwipeInput(swipe); swipeErr != nil {
+		h.logger.Warn("Invalid swipe", "code", swipeErr.code, "swiperId", userID, "swipedId", input.SwipedId, "preference", input.Preference)
+		return sendError(c, swipeErr)
+	}
+
+	// A request retried with the same Idempotency-Key gets the original
+	// response, even if the pair has matched or unmatched since
+	key := c.Get("Idempotency-Key")
+	if len(key) > maxIdempotencyKeyLength {
+		return sendError(c, errSwipeKeyTooLong)
+	}
+	if key != "" {
+		stored, ok, err := h.idempotency.GetSwipeResult(c.Context(), userID, key)
+		if err != nil {
+			h.logger.Error("Failed to get swipe result", "error", err)
+			return sendError(c, errSwipeInternal)
+		}
+		if ok {
+			if stored.SwipedId != input.SwipedId || stored.Preference != input.Preference {
+				h.logger.Warn("Idempotency-Key reused for a different swipe", "swiperId", userID, "swipedId", input.SwipedId)
+				return sendError(c, errSwipeKeyReused)
+			}
+			h.logger.Info("Replaying swipe result", "swiperId", userID, "swipedId", input.SwipedId)
+			return c.JSON(fiber.Map{"results": swipeResponse(stored.Matched, stored.MatchId)})
+		}
+	}
+
+	swipeErr, err := validateSwipeTarget(c.Context(), h.users, swipe)
+	if err != nil {
+		h.logger.Error("Failed to get swiped user", "error", err, "swipedId", input.SwipedId)
+		return sendError(c, errSwipeInternal)
+	}
+	if swipeErr != nil {
+		h.logger.Warn("Invalid swipe", "code", swipeErr.code, "swiperId", userID, "swipedId", input.SwipedId)
+		return sendError(c, swipeErr)
 	}
 
 	matched, matchID, err := h.storage.RecordSwipe(c.Context(), swipe)
 	if err != nil {
-		h.logger.Error("Failed to record swipe", "error", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record swipe"})
+		swipeErr := recordSwipeError(err)
+		switch swipeErr {
+		case errSwipeInternal:
+			h.logger.Error("Failed to record swipe", "error", err)
+		case errSwipeConflict:
+			c.Set(fiber.HeaderRetryAfter, "1")
+		}
+		return sendError(c, swipeErr)
+	}
+	if key != "" {
+		// The swipe itself is stored, and without the stored result a retry
+		// is still answered by the repeat swipe rules, so this is not fatal
+		err := h.idempotency.PutSwipeResult(c.Context(), userID, key, storage.SwipeResult{
+			SwipedId:   input.SwipedId,
+			Preference: input.Preference,
+			Matched:    matched,
+			MatchId:    matchID,
+			CreatedAt:  swipe.CreatedAt,
+		})
+		if err != nil {
+			h.logger.Warn("Failed to store swipe result", "error", err, "swiperId", userID)
+		}
 	}
 
+	// The swiper's arms are logged so match rates can be compared per arm
+	h.logger.Info("Swipe recorded successfully", "swiperId", userID, "swipedId", input.SwipedId, "preference", input.Preference, "matched", matched, "arms", h.experiments.Arms(userID))
+	return c.JSON(fiber.Map{"results": swipeResponse(matched, matchID)})
+}
+
+func swipeResponse(matched bool, matchID string) fiber.Map {
 	result := fiber.Map{"matched": matched}
 	if matched {
 		result["matchID"] = matchID
 	}
-
-	h.logger.Info("Swipe recorded successfully", "swiperId", userID, "swipedId", input.SwipedId, "matched", matched)
-	return c.JSON(fiber.Map{"results": result})
+	return result
 }
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dating-app-backend/internal/auth"
+	"dating-app-backend/internal/config"
+	"dating-app-backend/internal/experiment"
+	"dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TestSwipeIdempotencyKey checks that a swipe retried with the same
+// Idempotency-Key gets the original response without being counted again,
+// and that the key cannot be reused for a different swipe.
+func TestSwipeIdempotencyKey(t *testing.T) {
+	auth.InitJWTSecret("test")
+	log := &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	backends := []struct {
+		name string
+		new  func(t *testing.T) storage.Storage
+	}{
+		{"memory", func(t *testing.T) storage.Storage { return storage.NewMemory(&config.Config{SuperLikesPerDay: 1}, log) }},
+		{"sqlite", func(t *testing.T) storage.Storage {
+			store, err := storage.NewSQLite(&config.Config{SuperLikesPerDay: 1, SQLitePath: filepath.Join(t.TempDir(), "test.db")}, log)
+			if err != nil {
+				t.Fatalf("NewSQLite: %v", err)
+			}
+			return store
+		}},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+			ctx := context.Background()
+
+			swiper, swiped, other := model.GenerateRandomUser(), model.GenerateRandomUser(), model.GenerateRandomUser()
+			for _, user := range []model.User{swiper, swiped, other} {
+				if err := store.CreateUser(ctx, user); err != nil {
+					t.Fatalf("CreateUser: %v", err)
+				}
+			}
+
+			// The caller's ID is taken from the X-User header in place of a
+			// verified token. Fiber reuses the header's memory, so it is copied
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("user", jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": strings.Clone(c.Get("X-User"))}))
+				return c.Next()
+			})
+			h := NewSwipeHandler(store, store, store, &experiment.Registry{}, log)
+			app.Post("/swipe", h.RecordSwipe)
+
+			swipe := func(userID, key, swipedID string, preference model.SwipePreference) (int, map[string]any) {
+				t.Helper()
+				req := httptest.NewRequest(fiber.MethodPost, "/swipe", strings.NewReader(`{"swipedId":"`+swipedID+`","preference":"`+string(preference)+`"}`))
+				req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+				req.Header.Set("X-User", userID)
+				if key != "" {
+					req.Header.Set("Idempotency-Key", key)
+				}
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Fatalf("POST /swipe: %v", err)
+				}
+				defer resp.Body.Close()
+				var body map[string]any
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				return resp.StatusCode, body
+			}
+			results := func(body map[string]any) map[string]any {
+				results, _ := body["results"].(map[string]any)
+				return results
+			}
+
+			if status, body := swipe(swiper.ID, "key", swiped.ID, model.SwipeYes); status != fiber.StatusOK || results(body)["matched"] != false {
+				t.Fatalf("swipe = %d %v, want no match", status, body)
+			}
+			// The swiped user likes back, so the swipe would now report a match
+			if status, body := swipe(swiped.ID, "", swiper.ID, model.SwipeYes); status != fiber.StatusOK || results(body)["matched"] != true {
+				t.Fatalf("swipe back = %d %v, want a match", status, body)
+			}
+
+			if status, body := swipe(swiper.ID, "key", swiped.ID, model.SwipeYes); status != fiber.StatusOK || results(body)["matched"] != false || results(body)["matchID"] != nil {
+				t.Errorf("retried swipe = %d %v, want the original response", status, body)
+			}
+			if status, body := swipe(swiper.ID, "new key", swiped.ID, model.SwipeYes); status != fiber.StatusOK || results(body)["matched"] != true || results(body)["matchID"] == nil {
+				t.Errorf("repeat swipe with a new key = %d %v, want the match", status, body)
+			}
+			// Another user may use the same key
+			if status, body := swipe(other.ID, "key", swiped.ID, model.SwipeNo); status != fiber.StatusOK || results(body)["matched"] != false {
+				t.Errorf("swipe by another user = %d %v, want no match", status, body)
+			}
+
+			for _, reuse := range []struct {
+				name       string
+				swipedID   string
+				preference model.SwipePreference
+			}{
+				{"another user", other.ID, model.SwipeYes},
+				{"another preference", swiped.ID, model.SwipeNo},
+			} {
+				if status, body := swipe(swiper.ID, "key", reuse.swipedID, reuse.preference); status != fiber.StatusUnprocessableEntity || body["code"] != errSwipeKeyReused.code {
+					t.Errorf("key reused for %s = %d %v, want %d %s", reuse.name, status, body, fiber.StatusUnprocessableEntity, errSwipeKeyReused.code)
+				}
+			}
+
+			// swiped was swiped on once by swiper and once by other, and
+			// refused swipes were not recorded on other
+			for _, want := range []struct {
+				user       model.User
+				total, yes int
+			}{{swiped, 2, 1}, {other, 0, 0}} {
+				got, err := store.GetUserByID(ctx, want.user.ID)
+				if err != nil {
+					t.Fatalf("GetUserByID: %v", err)
+				}
+				if got.TotalSwipes != want.total || got.YesSwipes != want.yes {
+					t.Errorf("TotalSwipes, YesSwipes = %d, %d, want %d, %d", got.TotalSwipes, got.YesSwipes, want.total, want.yes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/storage"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The errors the swipe handler sends, besides the shared ones.
+var (
+	errSwipeInvalidPreference = &apiError{fiber.StatusBadRequest, "INVALID_PREFERENCE", `preference must be "YES", "NO" or "SUPER"`}
+	errSwipeMissingTarget     = &apiError{fiber.StatusBadRequest, "MISSING_TARGET", "swipedId is required"}
+	errSwipeKeyTooLong        = &apiError{fiber.StatusBadRequest, "IDEMPOTENCY_KEY_TOO_LONG", "Idempotency-Key is too long"}
+	errSwipeSelf              = &apiError{fiber.StatusUnprocessableEntity, "SELF_SWIPE", "You cannot swipe on yourself"}
+	errSwipeKeyReused         = &apiError{fiber.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "Idempotency-Key was already used for a different swipe"}
+	errSwipeUnknownTarget     = &apiError{fiber.StatusNotFound, "UNKNOWN_TARGET", "The swiped user does not exist"}
+	errSwipeTargetUnavailable = &apiError{fiber.StatusForbidden, "TARGET_UNAVAILABLE", "The swiped user is not available"}
+	errSwipeUnmatched         = &apiError{fiber.StatusForbidden, "UNMATCHED", "Your match with the swiped user has ended"}
+	errSwipeSuperLikeQuota    = &apiError{fiber.StatusTooManyRequests, "SUPER_LIKE_QUOTA_EXCEEDED", "You have no super-likes left today"}
+	errSwipeConflict          = &apiError{fiber.StatusServiceUnavailable, "SWIPE_CONFLICT", "The swiped user is being swiped on by many people at once, try again"}
+	errSwipeInternal          = errInternal.withMessage("Failed to record swipe")
+)
+
+// validateSwipeInput checks what can be checked from the request alone.
+func validateSwipeInput(swipe model.Swipe) *apiError {
+	if swipe.SwipedId == "" {
+		return errSwipeMissingTarget
+	}
+	if !swipe.Preference.Valid() {
+		return errSwipeInvalidPreference
+	}
+	if swipe.SwipedId == swipe.SwiperId {
+		return errSwipeSelf
+	}
+	return nil
+}
+
+// validateSwipeTarget checks that the swiped user exists and can be swiped
+// on. Deactivated users cannot. Users who have only hidden their profile
+// can: they are out of discovery, but may still be reached by ID, through a
+// shared link for instance.
+func validateSwipeTarget(ctx context.Context, users storage.UserRepository, swipe model.Swipe) (*apiError, error) {
+	target, err := users.GetUserByID(ctx, swipe.SwipedId)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return errSwipeUnknownTarget, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if target.Deactivated {
+		return errSwipeTargetUnavailable, nil
+	}
+	return nil, nil
+}
+
+// recordSwipeError maps an error from SwipeRepository.RecordSwipe to the
+// swipe error to send. Checks can race with the write, so storage reports
+// the same problems too.
+func recordSwipeError(err error) *apiError {
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		return errSwipeUnknownTarget
+	case errors.Is(err, storage.ErrUnmatched):
+		return errSwipeUnmatched
+	case errors.Is(err, storage.ErrSuperLikeQuotaExceeded):
+		return errSwipeSuperLikeQuota
+	case errors.Is(err, storage.ErrSwipeConflict):
+		return errSwipeConflict
+	}
+	return errSwipeInternal
+}
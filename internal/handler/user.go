@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"dating-app-backend/internal/auth"
 	"dating-app-backend/internal/logger"
 	"dating-app-backend/internal/model"
 	"dating-app-backend/internal/storage"
@@ -9,11 +10,11 @@ import (
 )
 
 type UserHandler struct {
-	storage *storage.DynamoDB
+	storage storage.UserRepository
 	logger  *logger.Logger
 }
 
-func NewUserHandler(storage *storage.DynamoDB, logger *logger.Logger) *UserHandler {
+func NewUserHandler(storage storage.UserRepository, logger *logger.Logger) *UserHandler {
 	return &UserHandler{storage: storage, logger: logger}
 }
 
@@ -26,9 +27,7 @@ func (h *UserHandler) CreateRandomUser(ctx *fiber.Ctx) error {
 	if err != nil {
 		msg := "Failed to store user"
 		h.logger.Error(msg, "error", err, "userId", user.ID)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": msg,
-		})
+		return sendError(ctx, errInternal.withMessage(msg))
 	}
 
 	h.logger.Info("Stored user", "userId", user.ID)
@@ -36,3 +35,30 @@ func (h *UserHandler) CreateRandomUser(ctx *fiber.Ctx) error {
 		"result": user,
 	})
 }
+
+// Deactivate takes the caller's account out of use: they disappear from
+// discovery and can no longer be swiped on, until they reactivate it.
+func (h *UserHandler) Deactivate(ctx *fiber.Ctx) error {
+	return h.setDeactivated(ctx, true)
+}
+
+// Reactivate undoes Deactivate.
+func (h *UserHandler) Reactivate(ctx *fiber.Ctx) error {
+	return h.setDeactivated(ctx, false)
+}
+
+func (h *UserHandler) setDeactivated(ctx *fiber.Ctx, deactivated bool) error {
+	userID, err := auth.GetUserIDFromToken(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get user ID from token", "error", err)
+		return sendError(ctx, errInvalidToken)
+	}
+
+	if err := h.storage.SetDeactivated(ctx.Context(), userID, deactivated); err != nil {
+		h.logger.Error("Failed to update user", "error", err, "userID", userID, "deactivated", deactivated)
+		return sendError(ctx, errInternal.withMessage("Failed to update account"))
+	}
+
+	h.logger.Info("Account updated successfully", "userID", userID, "deactivated", deactivated)
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
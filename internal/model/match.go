@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type MatchStatus string
+
+const (
+	MatchActive MatchStatus = "ACTIVE"
+	// MatchEnded is a match one of the users has unmatched. It is kept so
+	// the pair cannot match again, but neither user sees it any more.
+	MatchEnded MatchStatus = "ENDED"
+)
+
+// Match is a pair of users who both swiped YES on each other. UserAId is
+// always the lower of the two IDs, so a pair has one match whichever of them
+// swiped last.
+type Match struct {
+	ID        string      `json:"id" dynamodbav:"ID"`
+	UserAId   string      `json:"userAId" dynamodbav:"UserAId"`
+	UserBId   string      `json:"userBId" dynamodbav:"UserBId"`
+	CreatedAt time.Time   `json:"createdAt" dynamodbav:"CreatedAt"`
+	Status    MatchStatus `json:"status" dynamodbav:"Status"`
+}
+
+// NewMatch returns an active match between two users, created at createdAt.
+// Its ID is a ULID, so IDs sort by creation time.
+func NewMatch(userID, otherUserID string, createdAt time.Time) Match {
+	userAId, userBId := MatchPair(userID, otherUserID)
+	return Match{
+		ID:        ulid.MustNew(ulid.Timestamp(createdAt), ulid.DefaultEntropy()).String(),
+		UserAId:   userAId,
+		UserBId:   userBId,
+		CreatedAt: createdAt,
+		Status:    MatchActive,
+	}
+}
+
+// MatchPair orders two user IDs the way Match stores them.
+func MatchPair(userID, otherUserID string) (userAId, userBId string) {
+	if userID < otherUserID {
+		return userID, otherUserID
+	}
+	return otherUserID, userID
+}
+
+// Active reports whether the match is still on. Only the users of an active
+// match may message each other.
+func (m Match) Active() bool {
+	return m.Status == MatchActive
+}
+
+// OtherUserId returns the ID of userID's partner in the match.
+func (m Match) OtherUserId(userID string) string {
+	if m.UserAId == userID {
+		return m.UserBId
+	}
+	return m.UserAId
+}
+
+// UserMatch is a match as one of its users sees it.
+type UserMatch struct {
+	Match
+	// Unread is set until the user marks the match read. The user whose
+	// swipe completed the match has already seen it.
+	Unread bool
+}
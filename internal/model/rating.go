@@ -0,0 +1,46 @@
+package model
+
+import "math"
+
+const (
+	// InitialRating is the rating of a user nobody has swiped on yet. Users
+	// stored before ratings existed have a zero Rating and count as having
+	// this one.
+	InitialRating = 1500
+	// ratingK caps how far a single swipe can move a rating.
+	ratingK = 32
+)
+
+// CurrentRating returns the user's Elo rating.
+func (u *User) CurrentRating() float64 {
+	if u.Rating == 0 {
+		return InitialRating
+	}
+	return u.Rating
+}
+
+// UpdateRating applies a swipe by a user rated swiperRating to u's rating.
+// The swipe is scored like an Elo game between the two: a YES or SUPER is
+// a win for u and a NO a loss. A YES from a swiper rated above u therefore
+// gains more than one from a swiper rated below, and a NO from them costs
+// less.
+func (u *User) UpdateRating(swiperRating float64, preference SwipePreference) {
+	rating := u.CurrentRating()
+	expected := 1 / (1 + math.Pow(10, (swiperRating-rating)/400))
+
+	var actual float64
+	if preference.Likes() {
+		actual = 1
+	}
+	u.Rating = rating + ratingK*(actual-expected)
+}
+
+// ReviseSwipe applies a NO swipe on u being changed to a YES or SUPER. The
+// swipe was already counted, so only YesSwipes goes up, and it becomes a
+// win for u instead of a loss. Against the same expected score the two
+// differ by exactly ratingK.
+func (u *User) ReviseSwipe() {
+	u.YesSwipes++
+	u.UpdateAttractivenessScore()
+	u.Rating = u.CurrentRating() + ratingK
+}
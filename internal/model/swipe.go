@@ -9,11 +9,42 @@ type SwipePreference string
 const (
 	SwipeYes SwipePreference = "YES"
 	SwipeNo  SwipePreference = "NO"
+	// SwipeSuper is a YES that the swiped user is told about. Each user may
+	// only send a limited number a day.
+	SwipeSuper SwipePreference = "SUPER"
 )
 
+// Valid reports whether p is one of the known preferences.
+func (p SwipePreference) Valid() bool {
+	return p == SwipeYes || p == SwipeNo || p == SwipeSuper
+}
+
+// Likes reports whether p is a YES or a SUPER, which count the same for
+// matching and ratings.
+func (p SwipePreference) Likes() bool {
+	return p == SwipeYes || p == SwipeSuper
+}
+
+// SuperLike is a SUPER swipe as shown to the swiped user.
+type SuperLike struct {
+	SwiperId  string    `json:"swiperId"`
+	SwipedId  string    `json:"swipedId"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Unread is set until the swiped user marks their super-likes read.
+	Unread bool `json:"unread"`
+}
+
 type Swipe struct {
 	SwiperId   string          `json:"swiperId" dynamodbav:"SwiperId"`
 	SwipedId   string          `json:"swipedId" dynamodbav:"SwipedId"`
 	Preference SwipePreference `json:"preference" dynamodbav:"Preference"`
 	CreatedAt  time.Time       `json:"createdAt" dynamodbav:"CreatedAt"`
 }
+
+// CanReviseSwipe reports whether a swipe with preference to may replace an
+// earlier swipe on the same user with preference from. Only a NO can be
+// changed, to a YES or a SUPER. A YES or SUPER stands until the match it led
+// to is ended, and any other repeat swipe gets the result of the original.
+func CanReviseSwipe(from, to SwipePreference) bool {
+	return from == SwipeNo && to.Likes()
+}
@@ -1,7 +1,9 @@
 package model
 
 import (
+	"dating-app-backend/internal/geo"
 	"math/rand"
+	"slices"
 	"time"
 
 	"github.com/go-faker/faker/v4"
@@ -20,17 +22,75 @@ type User struct {
 	YesSwipes           int     `json:"yesSwipes" dynamodbav:"YesSwipes"`
 	TotalSwipes         int     `json:"totalSwipes" dynamodbav:"TotalSwipes"`
 	AttractivenessScore float64 `json:"attractivenessScore" dynamodbav:"AttractivenessScore"`
+	// Rating is an Elo rating driven by swipes; see UpdateRating.
+	Rating    float64  `json:"rating" dynamodbav:"Rating"`
+	Interests []string `json:"interests" dynamodbav:"Interests,omitempty"`
+	// Geohash is the geo.CellPrecision cell of the user's location. It keys
+	// the GeohashIndex used by discovery.
+	Geohash     string               `json:"-" dynamodbav:"Geohash,omitempty"`
+	Preferences DiscoveryPreferences `json:"preferences" dynamodbav:"Preferences"`
+	// Deactivated users have closed their account for now. Unlike users who
+	// hide their profile with Preferences.ShowMe, they cannot be swiped on
+	// either.
+	Deactivated bool `json:"deactivated" dynamodbav:"Deactivated,omitempty"`
+}
+
+// DiscoveryPreferences are the discovery filters a user has saved. Zero values
+// mean no filter.
+type DiscoveryPreferences struct {
+	MinAge        int      `json:"minAge" dynamodbav:"MinAge"`
+	MaxAge        int      `json:"maxAge" dynamodbav:"MaxAge"`
+	Genders       []string `json:"genders" dynamodbav:"Genders,omitempty"`
+	MaxDistanceKm float64  `json:"maxDistanceKm" dynamodbav:"MaxDistanceKm"`
+	// ShowMe controls whether the user appears in other people's discovery.
+	// It is nil for users who never set it, who are shown.
+	ShowMe *bool `json:"showMe,omitempty" dynamodbav:"ShowMe,omitempty"`
+}
+
+// Visible reports whether the user should appear in discovery.
+func (p DiscoveryPreferences) Visible() bool {
+	return p.ShowMe == nil || *p.ShowMe
+}
+
+// Accepts reports whether user, at distanceKm away, passes these
+// preferences.
+func (p DiscoveryPreferences) Accepts(user User, distanceKm float64) bool {
+	if p.MinAge > 0 && user.Age < p.MinAge {
+		return false
+	}
+	if p.MaxAge > 0 && user.Age > p.MaxAge {
+		return false
+	}
+	if len(p.Genders) > 0 && !slices.Contains(p.Genders, user.Gender) {
+		return false
+	}
+	if p.MaxDistanceKm > 0 && distanceKm > p.MaxDistanceKm {
+		return false
+	}
+	return true
 }
 
 type UserPublicData struct {
-	ID                  string  `json:"id"`
-	Name                string  `json:"name"`
-	Gender              string  `json:"gender"`
-	Age                 int     `json:"age"`
-	Latitude            float64 `json:"latitude"`
-	Longitude           float64 `json:"longitude"`
-	DistanceFromMe      float64 `json:"distanceFromMe"`
-	AttractivenessScore float64 `json:"attractivenessScore"`
+	ID                  string   `json:"id"`
+	Name                string   `json:"name"`
+	Gender              string   `json:"gender"`
+	Age                 int      `json:"age"`
+	Latitude            float64  `json:"latitude"`
+	Longitude           float64  `json:"longitude"`
+	DistanceFromMe      float64  `json:"distanceFromMe"`
+	AttractivenessScore float64  `json:"attractivenessScore"`
+	Rating              float64  `json:"rating"`
+	Interests           []string `json:"interests"`
+	// SuperLiked is set on discovery results who have super-liked the
+	// current user.
+	SuperLiked bool `json:"superLiked"`
+	// RecommendationScore is how strongly the current user's recommendations
+	// suggest this candidate, between 0 and 1. It is only filled in for
+	// rankers that use it.
+	RecommendationScore float64 `json:"-"`
+	// DiversityPenalty is how much diversity re-ranking held this candidate
+	// back for resembling candidates ahead of it, between 0 and 1.
+	DiversityPenalty float64 `json:"-"`
 }
 
 func (u *User) PublicData() UserPublicData {
@@ -42,22 +102,49 @@ func (u *User) PublicData() UserPublicData {
 		Latitude:            u.Latitude,
 		Longitude:           u.Longitude,
 		AttractivenessScore: u.AttractivenessScore,
+		Rating:              u.CurrentRating(),
+		Interests:           u.Interests,
 	}
 }
 
+// ScorePrior is the Bayesian prior behind AttractivenessScore. A user with no
+// swipes scores Mean, and their own YES ratio takes over as they collect
+// swipes, outweighing the prior once they have more than Weight of them.
+type ScorePrior struct {
+	Mean   float64
+	Weight float64
+}
+
+var scorePrior = ScorePrior{Mean: 0.5, Weight: 10}
+
+// InitScorePrior sets the prior used by UpdateAttractivenessScore.
+func InitScorePrior(prior ScorePrior) {
+	scorePrior = prior
+}
+
+// UpdateAttractivenessScore recomputes AttractivenessScore from the swipe
+// counters. The YES ratio is shrunk towards the prior mean so that a handful
+// of swipes cannot outrank a long track record.
 func (u *User) UpdateAttractivenessScore() {
-	if u.TotalSwipes > 0 {
-		u.AttractivenessScore = float64(u.YesSwipes) / float64(u.TotalSwipes)
-	} else {
-		u.AttractivenessScore = 0.5 // Default score for new users
+	if u.TotalSwipes == 0 {
+		u.AttractivenessScore = scorePrior.Mean
+		return
 	}
+	u.AttractivenessScore = (float64(u.YesSwipes) + scorePrior.Mean*scorePrior.Weight) /
+		(float64(u.TotalSwipes) + scorePrior.Weight)
+}
+
+// UpdateGeohash recomputes Geohash from the user's coordinates. It has to be
+// called whenever Latitude or Longitude change.
+func (u *User) UpdateGeohash() {
+	u.Geohash = geo.Cell(u.Latitude, u.Longitude)
 }
 
 func GenerateRandomUser() User {
 	entropy := ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
 	id := ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
 
-	return User{
+	user := User{
 		ID:    id,
 		Email: faker.Email(),
 		// TODO: Use a more secure password hashing algorithm
@@ -67,7 +154,13 @@ func GenerateRandomUser() User {
 		Age:       rand.Intn(62) + 18,
 		Latitude:  randomLatitude(),
 		Longitude: randomLongitude(),
+		Rating:    InitialRating,
+		Interests: randomInterests(3),
 	}
+	user.UpdateGeohash()
+	user.UpdateAttractivenessScore()
+
+	return user
 }
 
 func randomLatitude() float64 {
@@ -82,8 +175,20 @@ func (u *User) CheckPassword(password string) bool {
 	return u.Password == password
 }
 
+// Genders lists the gender values profiles can have.
+var Genders = []string{"Male", "Female"}
+
 func randomGender() string {
-	genders := []string{"Male", "Female"}
+	return Genders[rand.Intn(len(Genders))]
+}
 
-	return genders[rand.Intn(len(genders))]
+// Interests lists the interests profiles can have.
+var Interests = []string{"Art", "Cooking", "Fitness", "Gaming", "Hiking", "Movies", "Music", "Photography", "Reading", "Travel"}
+
+func randomInterests(n int) []string {
+	interests := make([]string, n)
+	for i, j := range rand.Perm(len(Interests))[:n] {
+		interests[i] = Interests[j]
+	}
+	return interests
 }
@@ -0,0 +1,116 @@
+package ranking
+
+import (
+	"dating-app-backend/internal/model"
+	"sort"
+)
+
+// distanceBandsMiles are the upper bounds of the distance bands candidates
+// are grouped into for diversity. The last band is open-ended.
+var distanceBandsMiles = []float64{1, 5, 10, 25, 50}
+
+// Diversify picks up to n candidates from pool, which must be in Score order,
+// by maximal marginal relevance. Candidates who have super-liked the current
+// user lead the pool and are picked first, in order. Each pick after them
+// maximises
+//
+//	(1-weight)*relevance - weight*similarity
+//
+// where relevance is r's score rescaled to [0, 1] over the pool and
+// similarity is the candidate's highest similarity to the candidates picked
+// before it. The picks are returned in order, with their DiversityPenalty
+// set. The first pick is always pool[0].
+func Diversify(r Ranker, pool []model.UserPublicData, n int, weight float64) []model.UserPublicData {
+	var result []model.UserPublicData
+	for len(pool) > 0 && len(result) < n && pool[0].SuperLiked {
+		result = append(result, pool[0])
+		pool = pool[1:]
+	}
+	return append(result, diversify(r, pool, n-len(result), weight)...)
+}
+
+// diversify is Diversify past the super-likes, which are left out so that
+// their boost does not squash the relevance of the rest.
+func diversify(r Ranker, pool []model.UserPublicData, n int, weight float64) []model.UserPublicData {
+	if len(pool) == 0 {
+		return nil
+	}
+
+	relevance := make([]float64, len(pool))
+	best, worst := r.Score(pool[0]), r.Score(pool[len(pool)-1])
+	for i, candidate := range pool {
+		relevance[i] = 1
+		if best > worst {
+			relevance[i] = (r.Score(candidate) - worst) / (best - worst)
+		}
+	}
+
+	// penalty[i] is pool[i]'s highest similarity to the picks so far
+	penalty := make([]float64, len(pool))
+	picked := make([]bool, len(pool))
+	var result []model.UserPublicData
+	for len(result) < n && len(result) < len(pool) {
+		next := -1
+		var nextValue float64
+		for i := range pool {
+			if picked[i] {
+				continue
+			}
+			// Ties go to the earlier candidate, so pool[0] is picked first
+			if value := (1-weight)*relevance[i] - weight*penalty[i]; next == -1 || value > nextValue {
+				next, nextValue = i, value
+			}
+		}
+
+		picked[next] = true
+		candidate := pool[next]
+		candidate.DiversityPenalty = penalty[next]
+		result = append(result, candidate)
+
+		for i := range pool {
+			if !picked[i] {
+				penalty[i] = max(penalty[i], similarity(pool[i], candidate))
+			}
+		}
+	}
+	return result
+}
+
+// similarity is the share of age band, distance band and interests two
+// candidates have in common, between 0 and 1.
+func similarity(a, b model.UserPublicData) float64 {
+	var shared float64
+	if a.Age/5 == b.Age/5 {
+		shared++
+	}
+	if distanceBand(a.DistanceFromMe) == distanceBand(b.DistanceFromMe) {
+		shared++
+	}
+	shared += jaccard(a.Interests, b.Interests)
+	return shared / 3
+}
+
+func distanceBand(miles float64) int {
+	return sort.SearchFloat64s(distanceBandsMiles, miles)
+}
+
+// jaccard is the size of the intersection of a and b over the size of their
+// union. It is zero when both are empty.
+func jaccard(a, b []string) float64 {
+	union := make(map[string]bool, len(a)+len(b))
+	for _, s := range a {
+		union[s] = true
+	}
+	var shared int
+	for _, s := range b {
+		if union[s] {
+			shared++
+		} else {
+			union[s] = true
+		}
+	}
+	if len(union) == 0 {
+		return 0
+	}
+	return float64(shared) / float64(len(union))
+}
@@ -0,0 +1,76 @@
+package ranking
+
+import "dating-app-backend/internal/model"
+
+// Distance puts the nearest candidates first.
+type Distance struct{}
+
+func (Distance) Name() string { return "distance" }
+
+func (Distance) Score(c model.UserPublicData) float64 {
+	return -c.DistanceFromMe
+}
+
+func (Distance) Explain(c model.UserPublicData) map[string]float64 {
+	return map[string]float64{"distance": c.DistanceFromMe}
+}
+
+// Attractiveness puts the candidates with the highest attractiveness score
+// first.
+type Attractiveness struct{}
+
+func (Attractiveness) Name() string { return "attractiveness" }
+
+func (Attractiveness) Score(c model.UserPublicData) float64 {
+	return c.AttractivenessScore
+}
+
+func (Attractiveness) Explain(c model.UserPublicData) map[string]float64 {
+	return map[string]float64{"attractiveness": c.AttractivenessScore}
+}
+
+// Rating puts the candidates with the highest Elo rating first.
+type Rating struct{}
+
+func (Rating) Name() string { return "rating" }
+
+func (Rating) Score(c model.UserPublicData) float64 {
+	return c.Rating
+}
+
+func (Rating) Explain(c model.UserPublicData) map[string]float64 {
+	return map[string]float64{"rating": c.Rating}
+}
+
+// Combined weighs attractiveness against distance.
+type Combined struct{}
+
+func (Combined) Name() string { return "combined" }
+
+func (Combined) Score(c model.UserPublicData) float64 {
+	return c.AttractivenessScore / (c.DistanceFromMe + 1)
+}
+
+// Explain reports the two factors whose product is the score.
+func (Combined) Explain(c model.UserPublicData) map[string]float64 {
+	return map[string]float64{"attractiveness": c.AttractivenessScore, "proximity": 1 / (c.DistanceFromMe + 1)}
+}
+
+// Recommended puts the candidates recommended from the current user's swipe
+// history first, and orders the rest by distance. The recommendation score
+// and a proximity score are added up, so a strong recommendation a few miles
+// away still beats an unrecommended candidate next door.
+type Recommended struct{}
+
+func (Recommended) Name() string { return "recommended" }
+
+func (Recommended) Score(c model.UserPublicData) float64 {
+	return c.RecommendationScore + 1/(c.DistanceFromMe+1)
+}
+
+// Explain reports the two terms whose sum is the score.
+func (Recommended) Explain(c model.UserPublicData) map[string]float64 {
+	return map[string]float64{"recommendation": c.RecommendationScore, "proximity": 1 / (c.DistanceFromMe + 1)}
+}
+
+func (Recommended) UsesRecommendations() {}
@@ -0,0 +1,139 @@
+package ranking
+
+import (
+	"dating-app-backend/internal/model"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Ranker orders discovery candidates. Candidates with a higher score come
+// first.
+type Ranker interface {
+	// Name is the value of sortBy that selects the ranker.
+	Name() string
+	Score(candidate model.UserPublicData) float64
+}
+
+// Explainer is implemented by rankers that can break a score down into its
+// components, for debugging the ranking.
+type Explainer interface {
+	Explain(candidate model.UserPublicData) map[string]float64
+}
+
+// Explanation describes how a ranker scored a candidate.
+type Explanation struct {
+	Ranker     string             `json:"ranker"`
+	Score      float64            `json:"score"`
+	Components map[string]float64 `json:"components"`
+}
+
+// superLikeBoost is added to the score of candidates who have super-liked
+// the current user. It is far above anything a ranker scores, so they rank
+// ahead of everyone else, in r's order among themselves.
+const superLikeBoost = 1e6
+
+// Score is r's score for candidate, boosted if the candidate has super-liked
+// the current user. Discovery ranks and paginates on it rather than on
+// r.Score.
+func Score(r Ranker, candidate model.UserPublicData) float64 {
+	score := r.Score(candidate)
+	if candidate.SuperLiked {
+		score += superLikeBoost
+	}
+	return score
+}
+
+// Explain scores candidate with r and, if r is an Explainer, breaks the
+// score down.
+func Explain(r Ranker, candidate model.UserPublicData) Explanation {
+	explanation := Explanation{Ranker: r.Name(), Score: Score(r, candidate)}
+	if explainer, ok := r.(Explainer); ok {
+		explanation.Components = explainer.Explain(candidate)
+	}
+	if candidate.SuperLiked {
+		if explanation.Components == nil {
+			explanation.Components = make(map[string]float64)
+		}
+		explanation.Components["superLike"] = superLikeBoost
+	}
+	if candidate.DiversityPenalty > 0 {
+		if explanation.Components == nil {
+			explanation.Components = make(map[string]float64)
+		}
+		explanation.Components["diversityPenalty"] = candidate.DiversityPenalty
+	}
+	return explanation
+}
+
+// RecommendationRanker is implemented by rankers that score candidates on
+// UserPublicData.RecommendationScore. Callers only load the current user's
+// recommendations for them.
+type RecommendationRanker interface {
+	Ranker
+	UsesRecommendations()
+}
+
+var (
+	mu      sync.RWMutex
+	rankers = make(map[string]Ranker)
+)
+
+// Register makes a ranker available by name. Like database/sql.Register it
+// panics if the name is taken, so it is meant to be called from init.
+func Register(r Ranker) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := rankers[r.Name()]; ok {
+		panic(fmt.Sprintf("ranking: Register called twice for ranker %q", r.Name()))
+	}
+	rankers[r.Name()] = r
+}
+
+// Get returns the ranker registered under name.
+func Get(name string) (Ranker, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	r, ok := rankers[name]
+	return r, ok
+}
+
+// Names returns the names of all registered rankers, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(rankers))
+	for name := range rankers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Before reports whether a candidate with scoreA and idA ranks before one
+// with scoreB and idB. Ties on score are broken by ID so the order is total,
+// which pagination relies on.
+func Before(scoreA float64, idA string, scoreB float64, idB string) bool {
+	if scoreA != scoreB {
+		return scoreA > scoreB
+	}
+	return idA < idB
+}
+
+// Sort orders candidates by Score, best first.
+func Sort(r Ranker, candidates []model.UserPublicData) {
+	sort.Slice(candidates, func(i, j int) bool {
+		return Before(Score(r, candidates[i]), candidates[i].ID, Score(r, candidates[j]), candidates[j].ID)
+	})
+}
+
+func init() {
+	Register(Distance{})
+	Register(Attractiveness{})
+	Register(Rating{})
+	Register(Recommended{})
+	Register(Combined{})
+}
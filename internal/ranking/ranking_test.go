@@ -0,0 +1,207 @@
+package ranking
+
+import (
+	"slices"
+	"testing"
+
+	"dating-app-backend/internal/model"
+)
+
+// candidate returns a candidate with the given ID, distance and
+// attractiveness score.
+func candidate(id string, distance, attractiveness float64) model.UserPublicData {
+	return model.UserPublicData{ID: id, DistanceFromMe: distance, AttractivenessScore: attractiveness}
+}
+
+// sortedIDs sorts candidates with r and returns their IDs in order.
+func sortedIDs(r Ranker, candidates ...model.UserPublicData) []string {
+	Sort(r, candidates)
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+func TestRankers(t *testing.T) {
+	tests := []struct {
+		name       string
+		ranker     Ranker
+		candidates []model.UserPublicData
+		want       []string
+	}{
+		{
+			name:       "distance puts the nearest first",
+			ranker:     Distance{},
+			candidates: []model.UserPublicData{candidate("far", 30, 0.9), candidate("near", 1, 0.1), candidate("mid", 10, 0.5)},
+			want:       []string{"near", "mid", "far"},
+		},
+		{
+			name:       "attractiveness puts the most attractive first",
+			ranker:     Attractiveness{},
+			candidates: []model.UserPublicData{candidate("low", 1, 0.1), candidate("high", 30, 0.9), candidate("mid", 10, 0.5)},
+			want:       []string{"high", "mid", "low"},
+		},
+		{
+			name:       "combined prefers the nearer of equally attractive candidates",
+			ranker:     Combined{},
+			candidates: []model.UserPublicData{candidate("far", 20, 0.5), candidate("near", 2, 0.5)},
+			want:       []string{"near", "far"},
+		},
+		{
+			name:       "combined prefers the more attractive of equally near candidates",
+			ranker:     Combined{},
+			candidates: []model.UserPublicData{candidate("low", 5, 0.2), candidate("high", 5, 0.8)},
+			want:       []string{"high", "low"},
+		},
+		{
+			name:   "combined weighs attractiveness against distance",
+			ranker: Combined{},
+			// 0.9/11, 0.3/1 and 0.6/4
+			candidates: []model.UserPublicData{candidate("attractive", 10, 0.9), candidate("close", 0, 0.3), candidate("balanced", 3, 0.6)},
+			want:       []string{"close", "balanced", "attractive"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortedIDs(tt.ranker, tt.candidates...); !slices.Equal(got, tt.want) {
+				t.Errorf("Sort = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testRanker scores every candidate the same.
+type testRanker struct{ name string }
+
+func (r testRanker) Name() string { return r.name }
+
+func (testRanker) Score(model.UserPublicData) float64 { return 0 }
+
+func TestRegistry(t *testing.T) {
+	Register(testRanker{name: "test"})
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(rankers, "test")
+	})
+
+	tests := []struct {
+		name   string
+		want   Ranker
+		wantOK bool
+	}{
+		{"distance", Distance{}, true},
+		{"attractiveness", Attractiveness{}, true},
+		{"rating", Rating{}, true},
+		{"recommended", Recommended{}, true},
+		{"combined", Combined{}, true},
+		{"test", testRanker{name: "test"}, true},
+		{"unknown", nil, false},
+		{"", nil, false},
+		{"Distance", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Get(tt.name)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Get(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	if !slices.Contains(Names(), "test") || !slices.IsSorted(Names()) {
+		t.Errorf("Names() = %v, want the registered rankers sorted", Names())
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranker Ranker
+		// want is the ranker that stays registered
+		want Ranker
+	}{
+		{"same ranker", Distance{}, Distance{}},
+		{"other ranker with a taken name", testRanker{name: "combined"}, Combined{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%q) did not panic", tt.ranker.Name())
+				}
+				if got, _ := Get(tt.ranker.Name()); got != tt.want {
+					t.Errorf("Get(%q) = %v after registering twice, want %v", tt.ranker.Name(), got, tt.want)
+				}
+			}()
+			Register(tt.ranker)
+		})
+	}
+}
+
+func TestBefore(t *testing.T) {
+	tests := []struct {
+		name           string
+		scoreA, scoreB float64
+		idA, idB       string
+		want           bool
+	}{
+		{"higher score first", 2, 1, "b", "a", true},
+		{"lower score after", 1, 2, "a", "b", false},
+		{"tie broken on lower ID", 1, 1, "a", "b", true},
+		{"tie with higher ID after", 1, 1, "b", "a", false},
+		{"not before itself", 1, 1, "a", "a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Before(tt.scoreA, tt.idA, tt.scoreB, tt.idB); got != tt.want {
+				t.Errorf("Before(%g, %q, %g, %q) = %v, want %v", tt.scoreA, tt.idA, tt.scoreB, tt.idB, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortTies(t *testing.T) {
+	tests := []struct {
+		name       string
+		ranker     Ranker
+		candidates []model.UserPublicData
+		want       []string
+	}{
+		{
+			name:       "equal scores in ID order",
+			ranker:     Attractiveness{},
+			candidates: []model.UserPublicData{candidate("c", 1, 0.5), candidate("a", 2, 0.5), candidate("b", 3, 0.5)},
+			want:       []string{"a", "b", "c"},
+		},
+		{
+			name:       "ties only broken within a score",
+			ranker:     Distance{},
+			candidates: []model.UserPublicData{candidate("b", 5, 0), candidate("c", 1, 0), candidate("a", 5, 0)},
+			want:       []string{"c", "a", "b"},
+		},
+		{
+			name:   "super-likes first, ties broken on ID",
+			ranker: Distance{},
+			candidates: []model.UserPublicData{
+				candidate("near", 1, 0),
+				{ID: "super-b", DistanceFromMe: 9, SuperLiked: true},
+				{ID: "super-a", DistanceFromMe: 9, SuperLiked: true},
+			},
+			want: []string{"super-a", "super-b", "near"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The order must not depend on the input order
+			reversed := slices.Clone(tt.candidates)
+			slices.Reverse(reversed)
+			for _, candidates := range [][]model.UserPublicData{tt.candidates, reversed} {
+				if got := sortedIDs(tt.ranker, candidates...); !slices.Equal(got, tt.want) {
+					t.Errorf("Sort = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
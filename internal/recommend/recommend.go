@@ -0,0 +1,99 @@
+// Package recommend builds per-user candidate lists from swipe history with
+// item-based collaborative filtering: users who liked X also liked Y.
+package recommend
+
+import (
+	"dating-app-backend/internal/model"
+	"math"
+	"sort"
+)
+
+// Builder accumulates swipes and turns them into candidate lists.
+type Builder struct {
+	// liked maps a swiper to the users they swiped YES on.
+	liked map[string][]string
+	// likers maps a user to the swipers who swiped YES on them.
+	likers map[string][]string
+	// swiped holds every (swiper, swiped) pair, whatever the preference, so
+	// users are never recommended someone they have already swiped on.
+	swiped map[string]map[string]bool
+}
+
+func NewBuilder() *Builder {
+	return &Builder{
+		liked:  make(map[string][]string),
+		likers: make(map[string][]string),
+		swiped: make(map[string]map[string]bool),
+	}
+}
+
+// Add records swipes. It can be called once per batch of a scan.
+func (b *Builder) Add(swipes []model.Swipe) {
+	for _, swipe := range swipes {
+		if b.swiped[swipe.SwiperId] == nil {
+			b.swiped[swipe.SwiperId] = make(map[string]bool)
+		}
+		if b.swiped[swipe.SwiperId][swipe.SwipedId] {
+			continue
+		}
+		b.swiped[swipe.SwiperId][swipe.SwipedId] = true
+
+		if swipe.Preference.Likes() {
+			b.liked[swipe.SwiperId] = append(b.liked[swipe.SwiperId], swipe.SwipedId)
+			b.likers[swipe.SwipedId] = append(b.likers[swipe.SwipedId], swipe.SwiperId)
+		}
+	}
+}
+
+// Swipers returns every user who has swiped, sorted.
+func (b *Builder) Swipers() []string {
+	swipers := make([]string, 0, len(b.swiped))
+	for swiper := range b.swiped {
+		swipers = append(swipers, swiper)
+	}
+	sort.Strings(swipers)
+	return swipers
+}
+
+// Recommend returns up to limit candidates for userID with scores between 0
+// and 1, the best one scoring 1.
+//
+// A candidate Y scores the sum, over every X that userID liked, of the
+// cosine similarity between the likers of X and the likers of Y. userID's
+// own likes are left out of the similarity so they do not count twice.
+func (b *Builder) Recommend(userID string, limit int) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, x := range b.liked[userID] {
+		for _, liker := range b.likers[x] {
+			if liker == userID {
+				continue
+			}
+			for _, y := range b.liked[liker] {
+				if y == userID || b.swiped[userID][y] {
+					continue
+				}
+				scores[y] += 1 / math.Sqrt(float64(len(b.likers[x])*len(b.likers[y])))
+			}
+		}
+	}
+
+	candidates := make([]string, 0, len(scores))
+	for candidate := range scores {
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if scores[candidates[i]] != scores[candidates[j]] {
+			return scores[candidates[i]] > scores[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	recommendations := make(map[string]float64, len(candidates))
+	for _, candidate := range candidates {
+		recommendations[candidate] = scores[candidate] / scores[candidates[0]]
+	}
+	return recommendations
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+
+	"dating-app-backend/internal/geo"
+	appModel "dating-app-backend/internal/model"
+	"dating-app-backend/internal/ranking"
+
+	"github.com/jftuga/geodist"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	// maxDiscoveryCandidates caps how many candidates are ranked together,
+	// in one Window.
+	maxDiscoveryCandidates = 1000
+	// diversityPoolFactor sets how many candidates, as a multiple of the
+	// page size, diversity re-ranking chooses each page from.
+	diversityPoolFactor = 3
+	// maxShown caps Position.Shown, which keeps cursors small. Past it the
+	// oldest passed-over candidates are skipped.
+	maxShown = 100
+)
+
+// searchRadiusKm returns the radius a discovery request should search.
+func searchRadiusKm(opts DiscoverOptions, configuredKm float64) float64 {
+	if opts.MaxDistanceKm > 0 && opts.MaxDistanceKm < configuredKm {
+		return opts.MaxDistanceKm
+	}
+	return configuredKm
+}
+
+// candidateFetcher returns up to n candidates that pass every discovery
+// filter and come after after in DistanceKey order, nearest first. A nil
+// after starts at the current user. It returns fewer than n only when no
+// more candidates follow.
+type candidateFetcher func(after *DistanceKey, n int) ([]appModel.User, error)
+
+// discover returns the page of candidates that starts right after
+// opts.After. Candidates are ranked a window of maxDiscoveryCandidates at a
+// time, nearest window first, and a page that uses up its window carries on
+// into the next one, so every candidate in range is eventually returned.
+func discover(ctx context.Context, currentUser appModel.User, opts DiscoverOptions, fetch candidateFetcher, rankings windowRankings) (DiscoverPage, error) {
+	limit := math.MaxInt
+	if opts.Limit > 0 {
+		limit = int(opts.Limit)
+	}
+	if opts.Ranker == nil {
+		opts.Ranker = ranking.Combined{}
+	}
+	var position Position
+	if opts.After != nil {
+		position = *opts.After
+	}
+
+	var page DiscoverPage
+	for {
+		users, err := fetch(position.Window.After, maxDiscoveryCandidates)
+		if err != nil {
+			return DiscoverPage{}, err
+		}
+		if last := position.Window.Last; last != nil {
+			users = slices.DeleteFunc(users, func(user appModel.User) bool {
+				return last.Before(candidateKey(currentUser, user))
+			})
+		} else if len(users) == maxDiscoveryCandidates {
+			last := candidateKey(currentUser, users[len(users)-1])
+			position.Window.Last = &last
+		}
+
+		ranked, err := rankWindow(ctx, currentUser, users, opts, position, rankings)
+		if err != nil {
+			return DiscoverPage{}, err
+		}
+		windowPage := rankedPage(ranked, opts, position, limit-len(page.Results))
+		page.Results = append(page.Results, windowPage.Results...)
+		if next := windowPage.Next; next != nil {
+			// The next page follows this ranking, so it has to be kept
+			if next.Window.Ranking == "" {
+				ids := make([]string, len(ranked))
+				for i, candidate := range ranked {
+					ids[i] = candidate.ID
+				}
+				next.Window.Ranking = ulid.Make().String()
+				if err := rankings.putWindowRanking(ctx, currentUser.ID, next.Window.Ranking, ids); err != nil {
+					return DiscoverPage{}, err
+				}
+			}
+			page.Next = next
+			return page, nil
+		}
+		if position.Window.Last == nil {
+			return page, nil
+		}
+
+		// The window is used up, so the next page starts the one after it
+		position = Position{Window: Window{After: position.Window.Last}}
+		if len(page.Results) == limit {
+			more, err := fetch(position.Window.After, 1)
+			if err != nil {
+				return DiscoverPage{}, err
+			}
+			if len(more) > 0 {
+				page.Next = &position
+			}
+			return page, nil
+		}
+	}
+}
+
+// rankWindow returns users, the candidates of after.Window, that come after
+// after in ranking order. A window is ranked on its first page. Later pages
+// keep to the ranking stored then, since scores change as candidates are
+// swiped on: candidates who no longer pass the filters are left out, and so
+// are ones who have moved into the window since.
+func rankWindow(ctx context.Context, currentUser appModel.User, users []appModel.User, opts DiscoverOptions, after Position, rankings windowRankings) ([]appModel.UserPublicData, error) {
+	publicUsers := toPublicUsers(currentUser, users)
+	for i := range publicUsers {
+		publicUsers[i].RecommendationScore = opts.Recommendations[publicUsers[i].ID]
+		publicUsers[i].SuperLiked = opts.SuperLikedBy[publicUsers[i].ID]
+	}
+
+	if after.Window.Ranking == "" {
+		// Only the first page of a window has no stored ranking
+		if after.ID != "" {
+			return nil, ErrRankingExpired
+		}
+		ranking.Sort(opts.Ranker, publicUsers)
+		return publicUsers, nil
+	}
+
+	ids, err := rankings.getWindowRanking(ctx, currentUser.ID, after.Window.Ranking)
+	if err != nil {
+		return nil, err
+	}
+	start := slices.Index(ids, after.ID) + 1
+	if start == 0 {
+		return nil, ErrRankingExpired
+	}
+
+	candidates := make(map[string]appModel.UserPublicData, len(publicUsers))
+	for _, candidate := range publicUsers {
+		candidates[candidate.ID] = candidate
+	}
+	ranked := make([]appModel.UserPublicData, 0, len(publicUsers))
+	for _, id := range ids[start:] {
+		if candidate, ok := candidates[id]; ok {
+			ranked = append(ranked, candidate)
+		}
+	}
+	return ranked, nil
+}
+
+// rankedPage returns up to limit of ranked, the candidates past after in
+// ranking order.
+func rankedPage(ranked []appModel.UserPublicData, opts DiscoverOptions, after Position, limit int) DiscoverPage {
+	if opts.Diversity > 0 {
+		return diversePage(opts.Ranker, ranked, opts, after, limit)
+	}
+
+	page := DiscoverPage{Results: ranked}
+	if len(ranked) > limit {
+		page.Results = ranked[:limit]
+		page.Next = &Position{ID: page.Results[limit-1].ID, Window: after.Window}
+	}
+	return page
+}
+
+// diversePage picks up to limit results from ranked, the candidates past
+// after in ranking order, with ranking.Diversify. Candidates it passes over
+// stay available: the next position only moves past the leading run of
+// shown candidates, and the ones shown beyond it are carried in
+// Position.Shown.
+func diversePage(ranker ranking.Ranker, ranked []appModel.UserPublicData, opts DiscoverOptions, after Position, limit int) DiscoverPage {
+	shown := make(map[string]bool)
+	for _, id := range after.Shown {
+		shown[id] = true
+	}
+
+	poolSize := limit
+	if limit <= math.MaxInt/diversityPoolFactor {
+		poolSize = limit * diversityPoolFactor
+	}
+	var pool []appModel.UserPublicData
+	for _, candidate := range ranked {
+		if len(pool) == poolSize {
+			break
+		}
+		if !shown[candidate.ID] {
+			pool = append(pool, candidate)
+		}
+	}
+
+	page := DiscoverPage{Results: ranking.Diversify(ranker, pool, limit, opts.Diversity)}
+	for _, result := range page.Results {
+		shown[result.ID] = true
+	}
+
+	// Move past the leading run of shown candidates, and past passed-over
+	// ones while too many shown candidates lie beyond them
+	remaining := 0
+	for _, candidate := range ranked {
+		if shown[candidate.ID] {
+			remaining++
+		}
+	}
+	consumed := 0
+	for consumed < len(ranked) && (shown[ranked[consumed].ID] || remaining > maxShown) {
+		if shown[ranked[consumed].ID] {
+			remaining--
+		}
+		consumed++
+	}
+	if consumed == len(ranked) {
+		return page
+	}
+	// Nothing was used up, so there is no position to continue from
+	if consumed == 0 {
+		return page
+	}
+
+	page.Next = &Position{ID: ranked[consumed-1].ID, Window: after.Window}
+	for _, candidate := range ranked[consumed:] {
+		if shown[candidate.ID] {
+			page.Next.Shown = append(page.Next.Shown, candidate.ID)
+		}
+	}
+	return page
+}
+
+// toPublicUsers converts candidates to their public representation and fills
+// in the distance from the current user.
+func toPublicUsers(currentUser appModel.User, users []appModel.User) []appModel.UserPublicData {
+	publicUsers := make([]appModel.UserPublicData, len(users))
+	for i, user := range users {
+		publicData := user.PublicData()
+		distance, _ := geodist.HaversineDistance(geodist.Coord{Lat: currentUser.Latitude, Lon: currentUser.Longitude},
+			geodist.Coord{Lat: user.Latitude, Lon: user.Longitude})
+		publicData.DistanceFromMe = distance
+		publicUsers[i] = publicData
+	}
+	return publicUsers
+}
+
+// matchesFilters applies the discovery filters in Go, for backends that
+// cannot push them into their queries.
+func matchesFilters(currentUser appModel.User, user appModel.User, seen *seenSet, opts DiscoverOptions) bool {
+	if user.ID == currentUser.ID {
+		return false
+	}
+	if seen.Has(user.ID) || !user.Preferences.Visible() || user.Deactivated {
+		return false
+	}
+	if !acceptsCurrentUser(currentUser, user) {
+		return false
+	}
+	if opts.MinAge > 0 && user.Age < opts.MinAge {
+		return false
+	}
+	if opts.MaxAge > 0 && user.Age > opts.MaxAge {
+		return false
+	}
+	if len(opts.Genders) > 0 && !slices.Contains(opts.Genders, user.Gender) {
+		return false
+	}
+	return true
+}
+
+// acceptsCurrentUser reports whether candidate's own preferences accept
+// currentUser. Discovery only returns candidates who would also be shown the
+// current user.
+func acceptsCurrentUser(currentUser, candidate appModel.User) bool {
+	return candidate.Preferences.Accepts(currentUser, distanceKm(currentUser, candidate))
+}
+
+func distanceKm(a, b appModel.User) float64 {
+	return geo.DistanceKm(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+}
+
+// candidateKey returns the DistanceKey of candidate.
+func candidateKey(currentUser, candidate appModel.User) DistanceKey {
+	return DistanceKey{Km: distanceKm(currentUser, candidate), ID: candidate.ID}
+}
+
+// isAfter reports whether candidate comes after after, which may be nil.
+func isAfter(currentUser, candidate appModel.User, after *DistanceKey) bool {
+	return after == nil || after.Before(candidateKey(currentUser, candidate))
+}
+
+// nearestUsers sorts users in DistanceKey order and keeps the first n.
+func nearestUsers(currentUser appModel.User, users []appModel.User, n int) []appModel.User {
+	sort.Slice(users, func(i, j int) bool {
+		return candidateKey(currentUser, users[i]).Before(candidateKey(currentUser, users[j]))
+	})
+	if len(users) > n {
+		users = users[:n]
+	}
+	return users
+}
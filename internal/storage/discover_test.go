@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+
+	appModel "dating-app-backend/internal/model"
+	"dating-app-backend/internal/ranking"
+)
+
+// TestDiscoverPagination pages through more candidates than one Window
+// holds and checks that every one of them is returned exactly once.
+func TestDiscoverPagination(t *testing.T) {
+	const candidates = maxDiscoveryCandidates*2 + 123
+
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+		{"postgres", func(t *testing.T) Storage { return newTestPostgres(t) }},
+	}
+	// Candidates are placed within ~30km, on a grid fine enough that only
+	// some share a location, or coarse enough that hundreds share each one
+	layouts := []struct {
+		name     string
+		latSteps int
+		lonSteps int
+	}{
+		{"spread", 500, 800},
+		{"co-located", 2, 3},
+	}
+	rankers := []ranking.Ranker{ranking.Distance{}, ranking.Rating{}, ranking.Combined{}}
+
+	for _, backend := range backends {
+		for _, layout := range layouts {
+			t.Run(backend.name+"/"+layout.name, func(t *testing.T) {
+				store := backend.new(t)
+
+				random := rand.New(rand.NewSource(1))
+				me := newTestUser("me", "Male", 30, testLat, testLon)
+				createTestUsers(t, store, me)
+				for range candidates {
+					lat := testLat + (float64(random.Intn(layout.latSteps))/float64(layout.latSteps)-0.5)/2
+					lon := testLon + (float64(random.Intn(layout.lonSteps))/float64(layout.lonSteps)-0.5)*0.8
+					user := newTestUser("", "Female", 30, lat, lon)
+					user.Email = user.ID + "@example.com"
+					user.Rating = float64(random.Intn(2000))
+					createTestUsers(t, store, user)
+				}
+
+				for _, ranker := range rankers {
+					t.Run(ranker.Name(), func(t *testing.T) {
+						seen := make(map[string]bool)
+						opts := DiscoverOptions{Limit: 37, Ranker: ranker}
+						for pages := 0; ; pages++ {
+							if pages > candidates {
+								t.Fatal("pagination does not end")
+							}
+							page, err := store.DiscoverUsers(context.Background(), me, opts)
+							if err != nil {
+								t.Fatalf("DiscoverUsers: %v", err)
+							}
+							for _, result := range page.Results {
+								if seen[result.ID] {
+									t.Fatalf("%s returned twice", result.ID)
+								}
+								seen[result.ID] = true
+							}
+							if page.Next == nil {
+								break
+							}
+							opts.After = page.Next
+						}
+						if len(seen) != candidates {
+							t.Errorf("returned %d candidates, want %d", len(seen), candidates)
+						}
+					})
+				}
+			})
+		}
+	}
+}
+
+// TestDiscoverWindowEdge checks that a page ending exactly on a Window's
+// edge points at the next window only when it holds candidates.
+func TestDiscoverWindowEdge(t *testing.T) {
+	tests := []struct {
+		name     string
+		extra    int
+		wantNext bool
+	}{
+		{"more beyond", 1, true},
+		{"nothing beyond", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemory(testConfig(), testLogger())
+			me := newTestUser("me", "Male", 30, testLat, testLon)
+			createTestUsers(t, store, me)
+			for i := range maxDiscoveryCandidates + tt.extra {
+				user := newTestUser("", "Female", 30, testLat+float64(i)/10000, testLon)
+				user.Email = user.ID + "@example.com"
+				createTestUsers(t, store, user)
+			}
+
+			page, err := store.DiscoverUsers(context.Background(), me, DiscoverOptions{Limit: maxDiscoveryCandidates, Ranker: ranking.Distance{}})
+			if err != nil {
+				t.Fatalf("DiscoverUsers: %v", err)
+			}
+			if len(page.Results) != maxDiscoveryCandidates {
+				t.Fatalf("returned %d candidates, want %d", len(page.Results), maxDiscoveryCandidates)
+			}
+			if gotNext := page.Next != nil; gotNext != tt.wantNext {
+				t.Errorf("Next = %+v, want a next page: %v", page.Next, tt.wantNext)
+			}
+		})
+	}
+}
+
+// TestDiscoverScoreChanges checks that pages keep to the ranking of the
+// first one while candidates' scores change in between.
+func TestDiscoverScoreChanges(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+			ctx := context.Background()
+
+			me := newTestUser("me", "Male", 30, testLat, testLon)
+			createTestUsers(t, store, me)
+			candidates := make(map[string]appModel.User)
+			for i, name := range []string{"a", "b", "c", "d"} {
+				user := newTestUser(name, "Female", 30, testLat+float64(i)/100, testLon)
+				user.AttractivenessScore = 0.9 - float64(i)/10
+				createTestUsers(t, store, user)
+				candidates[name] = user
+			}
+
+			opts := DiscoverOptions{Limit: 2, Ranker: ranking.Attractiveness{}}
+			first, err := store.DiscoverUsers(ctx, me, opts)
+			if err != nil {
+				t.Fatalf("DiscoverUsers: %v", err)
+			}
+
+			// c overtakes the first page and b falls behind the rest
+			for name, score := range map[string]float64{"c": 0.95, "b": 0.1} {
+				user := candidates[name]
+				user.AttractivenessScore = score
+				if err := store.UpdateUser(ctx, &user); err != nil {
+					t.Fatalf("UpdateUser: %v", err)
+				}
+			}
+
+			opts.After = first.Next
+			second, err := store.DiscoverUsers(ctx, me, opts)
+			if err != nil {
+				t.Fatalf("DiscoverUsers: %v", err)
+			}
+			var names []string
+			for _, result := range append(first.Results, second.Results...) {
+				names = append(names, result.Name)
+			}
+			if want := []string{"a", "b", "c", "d"}; !slices.Equal(names, want) || second.Next != nil {
+				t.Errorf("pages = %v, next %+v, want %v and no more", names, second.Next, want)
+			}
+
+			// A cursor whose ranking is gone cannot be continued
+			expired := *first.Next
+			expired.Window.Ranking = "missing"
+			opts.After = &expired
+			if _, err := store.DiscoverUsers(ctx, me, opts); !errors.Is(err, ErrRankingExpired) {
+				t.Errorf("DiscoverUsers with an expired ranking = %v, want %v", err, ErrRankingExpired)
+			}
+		})
+	}
+}
+
+func TestDiversePage(t *testing.T) {
+	ranked := []appModel.UserPublicData{{ID: "a", AttractivenessScore: 0.9}, {ID: "b", AttractivenessScore: 0.5}}
+
+	tests := []struct {
+		name     string
+		ranked   []appModel.UserPublicData
+		limit    int
+		want     int
+		wantNext bool
+	}{
+		{"no candidates", nil, 10, 0, false},
+		{"nothing to pick", ranked, 0, 0, false},
+		{"some left", ranked, 1, 1, true},
+		{"all picked", ranked, 2, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := diversePage(ranking.Attractiveness{}, tt.ranked, DiscoverOptions{Diversity: 0.5}, Position{}, tt.limit)
+			if len(page.Results) != tt.want || (page.Next != nil) != tt.wantNext {
+				t.Errorf("diversePage = %d results, next %+v, want %d results, a next page: %v", len(page.Results), page.Next, tt.want, tt.wantNext)
+			}
+		})
+	}
+}
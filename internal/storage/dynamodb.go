@@ -5,6 +5,8 @@ import (
 	appConfig "dating-app-backend/internal/config"
 	appLogger "dating-app-backend/internal/logger"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -13,9 +15,19 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+const (
+	// indexBuildTimeout bounds how long start-up waits for a new index to be
+	// built from the existing items.
+	indexBuildTimeout = 30 * time.Minute
+	indexPollInterval = 5 * time.Second
+)
+
 type DynamoDB struct {
-	client *dynamodb.Client
-	logger *appLogger.Logger
+	client           *dynamodb.Client
+	radiusKm         float64
+	superLikesPerDay int
+	seen             *seenCache
+	logger           *appLogger.Logger
 }
 
 func NewDynamoDB(cfg *appConfig.Config, logger *appLogger.Logger) (*DynamoDB, error) {
@@ -43,16 +55,52 @@ func NewDynamoDB(cfg *appConfig.Config, logger *appLogger.Logger) (*DynamoDB, er
 
 	client := dynamodb.NewFromConfig(defaultConfig)
 
-	db := &DynamoDB{client: client, logger: logger}
+	db := &DynamoDB{client: client, radiusKm: cfg.DiscoveryRadiusKm, superLikesPerDay: cfg.SuperLikesPerDay, seen: newSeenCache(), logger: logger}
 
 	if err := db.createUsersTable(); err != nil {
 		return nil, err
 	}
 
+	if err := db.ensureGeohashIndex(); err != nil {
+		return nil, err
+	}
+
 	if err := db.createSwipesTable(); err != nil {
 		return nil, err
 	}
 
+	if err := db.createRecommendationsTable(); err != nil {
+		return nil, err
+	}
+
+	if err := db.createPicksTable(); err != nil {
+		return nil, err
+	}
+
+	if err := db.createMatchesTable(); err != nil {
+		return nil, err
+	}
+
+	if err := db.createUserMatchesTable(); err != nil {
+		return nil, err
+	}
+
+	if err := db.createSwipeIdempotencyKeysTable(); err != nil {
+		return nil, err
+	}
+
+	if err := db.createSuperLikesTable(); err != nil {
+		return nil, err
+	}
+
+	if err := db.createSuperLikeQuotasTable(); err != nil {
+		return nil, err
+	}
+
+	if err := db.createWindowRankingsTable(); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -68,6 +116,10 @@ func (db *DynamoDB) createUsersTable() error {
 				AttributeName: aws.String("Email"),
 				AttributeType: types.ScalarAttributeTypeS,
 			},
+			{
+				AttributeName: aws.String("Geohash"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
 		},
 		KeySchema: []types.KeySchemaElement{
 			{
@@ -89,6 +141,7 @@ func (db *DynamoDB) createUsersTable() error {
 					ProjectionType: types.ProjectionTypeAll,
 				},
 			},
+			geohashIndex(),
 		},
 		BillingMode: types.BillingModePayPerRequest,
 	}
@@ -108,6 +161,98 @@ func (db *DynamoDB) createUsersTable() error {
 	return nil
 }
 
+func geohashIndex() types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(geohashIndexName),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("Geohash"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+	}
+}
+
+// ensureGeohashIndex adds the GeohashIndex to a Users table that was created
+// before discovery used it.
+func (db *DynamoDB) ensureGeohashIndex() error {
+	table, err := db.client.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{
+		TableName: aws.String(usersTableName),
+	})
+	if err != nil {
+		db.logger.Error("Failed to describe Users table", "error", err)
+		return err
+	}
+
+	for _, index := range table.Table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == geohashIndexName {
+			// It may still be building, after a fresh create or when
+			// another instance added it
+			return db.waitForGeohashIndex()
+		}
+	}
+
+	index := geohashIndex()
+	_, err = db.client.UpdateTable(context.TODO(), &dynamodb.UpdateTableInput{
+		TableName: aws.String(usersTableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("Geohash"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:  index.IndexName,
+					KeySchema:  index.KeySchema,
+					Projection: index.Projection,
+				},
+			},
+		},
+	})
+	if err != nil {
+		db.logger.Error("Failed to add GeohashIndex to Users table", "error", err)
+		return err
+	}
+
+	db.logger.Info("Adding GeohashIndex to Users table")
+	return db.waitForGeohashIndex()
+}
+
+// waitForGeohashIndex blocks until the GeohashIndex is ACTIVE. A new index is
+// first built from the existing users, and discovery cannot query it before
+// then.
+func (db *DynamoDB) waitForGeohashIndex() error {
+	ctx, cancel := context.WithTimeout(context.TODO(), indexBuildTimeout)
+	defer cancel()
+
+	for {
+		table, err := db.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(usersTableName),
+		})
+		if err != nil {
+			db.logger.Error("Failed to describe Users table", "error", err)
+			return err
+		}
+		for _, index := range table.Table.GlobalSecondaryIndexes {
+			if aws.ToString(index.IndexName) == geohashIndexName && index.IndexStatus == types.IndexStatusActive {
+				return nil
+			}
+		}
+
+		db.logger.Info("Waiting for GeohashIndex to become active")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("GeohashIndex not active after %s", indexBuildTimeout)
+		case <-time.After(indexPollInterval):
+		}
+	}
+}
+
 func (db *DynamoDB) createSwipesTable() error {
 	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
 		AttributeDefinitions: []types.AttributeDefinition{
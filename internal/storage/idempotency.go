@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	appModel "dating-app-backend/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const swipeIdempotencyKeysTableName = "SwipeIdempotencyKeysTable"
+
+// swipeResultItem is a SwipeResult stored under a user's idempotency key.
+// DynamoDB deletes it some time after ExpiresAt, a Unix time in seconds.
+type swipeResultItem struct {
+	UserId         string                   `dynamodbav:"UserId"`
+	IdempotencyKey string                   `dynamodbav:"IdempotencyKey"`
+	SwipedId       string                   `dynamodbav:"SwipedId"`
+	Preference     appModel.SwipePreference `dynamodbav:"Preference"`
+	Matched        bool                     `dynamodbav:"Matched"`
+	MatchId        string                   `dynamodbav:"MatchId"`
+	CreatedAt      time.Time                `dynamodbav:"CreatedAt"`
+	ExpiresAt      int64                    `dynamodbav:"ExpiresAt"`
+}
+
+func (db *DynamoDB) createSwipeIdempotencyKeysTable() error {
+	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("UserId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("IdempotencyKey"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("UserId"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("IdempotencyKey"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		TableName:   aws.String(swipeIdempotencyKeysTableName),
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var resourceInUseErr *types.ResourceInUseException
+		if errors.As(err, &resourceInUseErr) {
+			db.logger.Warn("SwipeIdempotencyKeys table already exists")
+			return nil
+		}
+		db.logger.Error("Failed to create SwipeIdempotencyKeys table", "error", err)
+		return err
+	}
+
+	if err := db.enableTimeToLive(swipeIdempotencyKeysTableName); err != nil {
+		db.logger.Error("Failed to enable time to live on SwipeIdempotencyKeys table", "error", err)
+		return err
+	}
+
+	db.logger.Info("Successfully created SwipeIdempotencyKeys table")
+	return nil
+}
+
+// enableTimeToLive has DynamoDB delete the items of the new table
+// tableName once their ExpiresAt, a Unix time in seconds, has passed.
+func (db *DynamoDB) enableTimeToLive(tableName string) error {
+	// Time to live can only be turned on once the table is active
+	err := dynamodb.NewTableExistsWaiter(db.client).Wait(context.TODO(), &dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	}, time.Minute)
+	if err != nil {
+		return err
+	}
+	_, err = db.client.UpdateTimeToLive(context.TODO(), &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("ExpiresAt"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return err
+}
+
+func (db *DynamoDB) GetSwipeResult(ctx context.Context, userID, key string) (SwipeResult, bool, error) {
+	result, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(swipeIdempotencyKeysTableName),
+		Key: map[string]types.AttributeValue{
+			"UserId":         &types.AttributeValueMemberS{Value: userID},
+			"IdempotencyKey": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		db.logger.Error("Failed to get swipe result from DynamoDB", "error", err, "userId", userID)
+		return SwipeResult{}, false, err
+	}
+	if result.Item == nil {
+		return SwipeResult{}, false, nil
+	}
+
+	var item swipeResultItem
+	if err := attributevalue.UnmarshalMap(result.Item, &item); err != nil {
+		db.logger.Error("Failed to unmarshal swipe result", "error", err, "userId", userID)
+		return SwipeResult{}, false, err
+	}
+
+	// Expired items linger until DynamoDB gets round to deleting them
+	swipeResult := SwipeResult{
+		SwipedId:   item.SwipedId,
+		Preference: item.Preference,
+		Matched:    item.Matched,
+		MatchId:    item.MatchId,
+		CreatedAt:  item.CreatedAt,
+	}
+	if swipeResult.expired() {
+		return SwipeResult{}, false, nil
+	}
+	return swipeResult, true, nil
+}
+
+func (db *DynamoDB) PutSwipeResult(ctx context.Context, userID, key string, result SwipeResult) error {
+	item, err := attributevalue.MarshalMap(swipeResultItem{
+		UserId:         userID,
+		IdempotencyKey: key,
+		SwipedId:       result.SwipedId,
+		Preference:     result.Preference,
+		Matched:        result.Matched,
+		MatchId:        result.MatchId,
+		CreatedAt:      result.CreatedAt,
+		ExpiresAt:      result.CreatedAt.Add(IdempotencyKeyTTL).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(swipeIdempotencyKeysTableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(UserId) OR ExpiresAt < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	// A result that has not expired is already stored
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	if err != nil {
+		db.logger.Error("Failed to put swipe result in DynamoDB", "error", err, "userId", userID)
+		return err
+	}
+	return nil
+}
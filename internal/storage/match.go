@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	appModel "dating-app-backend/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	matchesTableName = "MatchesTable"
+	// userMatchesTableName holds a copy of every match per participant,
+	// keyed by user and match ID, so a user's matches can be listed newest
+	// first with a single query.
+	userMatchesTableName = "UserMatchesTable"
+)
+
+// userMatchItem is a match as stored for one of its users.
+type userMatchItem struct {
+	UserId      string               `dynamodbav:"UserId"`
+	MatchId     string               `dynamodbav:"MatchId"`
+	OtherUserId string               `dynamodbav:"OtherUserId"`
+	CreatedAt   time.Time            `dynamodbav:"CreatedAt"`
+	Status      appModel.MatchStatus `dynamodbav:"Status"`
+	Unread      bool                 `dynamodbav:"Unread"`
+}
+
+func newUserMatchItem(match appModel.Match, userID string, unread bool) userMatchItem {
+	return userMatchItem{
+		UserId:      userID,
+		MatchId:     match.ID,
+		OtherUserId: match.OtherUserId(userID),
+		CreatedAt:   match.CreatedAt,
+		Status:      match.Status,
+		Unread:      unread,
+	}
+}
+
+func (item userMatchItem) userMatch() appModel.UserMatch {
+	userAId, userBId := appModel.MatchPair(item.UserId, item.OtherUserId)
+	return appModel.UserMatch{
+		Match: appModel.Match{
+			ID:        item.MatchId,
+			UserAId:   userAId,
+			UserBId:   userBId,
+			CreatedAt: item.CreatedAt,
+			Status:    item.Status,
+		},
+		Unread: item.Unread,
+	}
+}
+
+// matchPairItem guards against storing two matches for one pair. It lives in
+// the Matches table under a "PAIR#" key and points at the pair's match,
+// whose status it mirrors.
+type matchPairItem struct {
+	ID      string               `dynamodbav:"ID"`
+	MatchId string               `dynamodbav:"MatchId"`
+	Status  appModel.MatchStatus `dynamodbav:"Status"`
+}
+
+func matchPairKey(userAId, userBId string) string {
+	return "PAIR#" + userAId + "#" + userBId
+}
+
+func (db *DynamoDB) createMatchesTable() error {
+	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("ID"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("ID"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		TableName:   aws.String(matchesTableName),
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var resourceInUseErr *types.ResourceInUseException
+		if errors.As(err, &resourceInUseErr) {
+			db.logger.Warn("Matches table already exists")
+			return nil
+		}
+		db.logger.Error("Failed to create Matches table", "error", err)
+		return err
+	}
+	db.logger.Info("Successfully created Matches table")
+	return nil
+}
+
+func (db *DynamoDB) createUserMatchesTable() error {
+	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("UserId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("MatchId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("UserId"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("MatchId"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		TableName:   aws.String(userMatchesTableName),
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var resourceInUseErr *types.ResourceInUseException
+		if errors.As(err, &resourceInUseErr) {
+			db.logger.Warn("UserMatches table already exists")
+			return nil
+		}
+		db.logger.Error("Failed to create UserMatches table", "error", err)
+		return err
+	}
+	db.logger.Info("Successfully created UserMatches table")
+	return nil
+}
+
+// matchWrites returns the transaction items that store match, completed by
+// swipe. The first is the pair guard, which fails if the pair already has a
+// match.
+func matchWrites(match appModel.Match, swipe appModel.Swipe) ([]types.TransactWriteItem, error) {
+	matchItem, err := attributevalue.MarshalMap(match)
+	if err != nil {
+		return nil, err
+	}
+	pairItem, err := attributevalue.MarshalMap(matchPairItem{ID: matchPairKey(match.UserAId, match.UserBId), MatchId: match.ID, Status: match.Status})
+	if err != nil {
+		return nil, err
+	}
+	// The swiper sees the match in the swipe response, so it is only unread
+	// for the swiped user
+	swiperItem, err := attributevalue.MarshalMap(newUserMatchItem(match, swipe.SwiperId, false))
+	if err != nil {
+		return nil, err
+	}
+	swipedItem, err := attributevalue.MarshalMap(newUserMatchItem(match, swipe.SwipedId, true))
+	if err != nil {
+		return nil, err
+	}
+
+	return []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:           aws.String(matchesTableName),
+			Item:                pairItem,
+			ConditionExpression: aws.String("attribute_not_exists(ID)"),
+		}},
+		{Put: &types.Put{TableName: aws.String(matchesTableName), Item: matchItem}},
+		{Put: &types.Put{TableName: aws.String(userMatchesTableName), Item: swiperItem}},
+		{Put: &types.Put{TableName: aws.String(userMatchesTableName), Item: swipedItem}},
+	}, nil
+}
+
+// getPairMatch returns the ID and status of the match between two users, as
+// recorded by their pair guard.
+func (db *DynamoDB) getPairMatch(ctx context.Context, userAId, userBId string) (string, appModel.MatchStatus, error) {
+	result, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(matchesTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: matchPairKey(userAId, userBId)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	var existing matchPairItem
+	if err := attributevalue.UnmarshalMap(result.Item, &existing); err != nil {
+		return "", "", err
+	}
+	return existing.MatchId, existing.Status, nil
+}
+
+// transactionConditionFailed reports whether err is a transaction failing
+// on the condition of its item at index.
+func transactionConditionFailed(err error, index int) bool {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) || len(canceled.CancellationReasons) <= index {
+		return false
+	}
+	return aws.ToString(canceled.CancellationReasons[index].Code) == "ConditionalCheckFailed"
+}
+
+func (db *DynamoDB) ListMatches(ctx context.Context, userID string, opts ListMatchesOptions) (MatchPage, error) {
+	keyCondition := "UserId = :userId"
+	values := map[string]types.AttributeValue{
+		":userId": &types.AttributeValueMemberS{Value: userID},
+	}
+	if opts.Before != "" {
+		keyCondition += " AND MatchId < :before"
+		values[":before"] = &types.AttributeValueMemberS{Value: opts.Before}
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(userMatchesTableName),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(opts.Limit + 1),
+	}
+	if opts.UnreadOnly {
+		input.FilterExpression = aws.String("Unread = :unread")
+		values[":unread"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+
+	// Fetch one match past the limit to know whether another page follows.
+	// The filter applies after Limit, so keep paging until there are enough.
+	var matches []appModel.UserMatch
+	paginator := dynamodb.NewQueryPaginator(db.client, input)
+	for paginator.HasMorePages() && len(matches) <= int(opts.Limit) {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			db.logger.Error("Failed to query matches", "error", err, "userId", userID)
+			return MatchPage{}, err
+		}
+
+		var items []userMatchItem
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			db.logger.Error("Failed to unmarshal matches", "error", err, "userId", userID)
+			return MatchPage{}, err
+		}
+		for _, item := range items {
+			matches = append(matches, item.userMatch())
+		}
+	}
+
+	if len(matches) > int(opts.Limit)+1 {
+		matches = matches[:opts.Limit+1]
+	}
+	return matchPage(matches, opts.Limit), nil
+}
+
+func (db *DynamoDB) MarkMatchRead(ctx context.Context, userID string, matchID string) error {
+	_, err := db.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(userMatchesTableName),
+		Key: map[string]types.AttributeValue{
+			"UserId":  &types.AttributeValueMemberS{Value: userID},
+			"MatchId": &types.AttributeValueMemberS{Value: matchID},
+		},
+		UpdateExpression:    aws.String("SET Unread = :unread"),
+		ConditionExpression: aws.String("attribute_exists(UserId)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":unread": &types.AttributeValueMemberBOOL{Value: false},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrMatchNotFound
+	}
+	if err != nil {
+		db.logger.Error("Failed to mark match read", "error", err, "userId", userID, "matchId", matchID)
+		return err
+	}
+	return nil
+}
+
+func (db *DynamoDB) EndMatch(ctx context.Context, userID string, matchID string) error {
+	result, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(matchesTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: matchID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		db.logger.Error("Failed to get match", "error", err, "matchId", matchID)
+		return err
+	}
+	if result.Item == nil {
+		return ErrMatchNotFound
+	}
+	var match appModel.Match
+	if err := attributevalue.UnmarshalMap(result.Item, &match); err != nil {
+		db.logger.Error("Failed to unmarshal match", "error", err, "matchId", matchID)
+		return err
+	}
+	if !match.Active() || (match.UserAId != userID && match.UserBId != userID) {
+		return ErrMatchNotFound
+	}
+
+	// The match and its pair guard are kept, marked ended, so the pair cannot
+	// match again. Their copies in UserMatches go, which hides the match from
+	// both users.
+	names := map[string]string{"#status": "Status"}
+	_, err = db.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Update: &types.Update{
+				TableName: aws.String(matchesTableName),
+				Key: map[string]types.AttributeValue{
+					"ID": &types.AttributeValueMemberS{Value: match.ID},
+				},
+				UpdateExpression:         aws.String("SET #status = :ended"),
+				ConditionExpression:      aws.String("#status = :active"),
+				ExpressionAttributeNames: names,
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":ended":  &types.AttributeValueMemberS{Value: string(appModel.MatchEnded)},
+					":active": &types.AttributeValueMemberS{Value: string(appModel.MatchActive)},
+				},
+			}},
+			{Update: &types.Update{
+				TableName: aws.String(matchesTableName),
+				Key: map[string]types.AttributeValue{
+					"ID": &types.AttributeValueMemberS{Value: matchPairKey(match.UserAId, match.UserBId)},
+				},
+				UpdateExpression:         aws.String("SET #status = :ended"),
+				ExpressionAttributeNames: names,
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":ended": &types.AttributeValueMemberS{Value: string(appModel.MatchEnded)},
+				},
+			}},
+			{Delete: &types.Delete{
+				TableName: aws.String(userMatchesTableName),
+				Key: map[string]types.AttributeValue{
+					"UserId":  &types.AttributeValueMemberS{Value: match.UserAId},
+					"MatchId": &types.AttributeValueMemberS{Value: match.ID},
+				},
+			}},
+			{Delete: &types.Delete{
+				TableName: aws.String(userMatchesTableName),
+				Key: map[string]types.AttributeValue{
+					"UserId":  &types.AttributeValueMemberS{Value: match.UserBId},
+					"MatchId": &types.AttributeValueMemberS{Value: match.ID},
+				},
+			}},
+		},
+	})
+	// Someone else ended it first
+	if transactionConditionFailed(err, 0) {
+		return ErrMatchNotFound
+	}
+	if err != nil {
+		db.logger.Error("Failed to end match", "error", err, "userId", userID, "matchId", matchID)
+		return err
+	}
+
+	db.logger.Info("Match ended", "userId", userID, "matchId", matchID)
+	return nil
+}
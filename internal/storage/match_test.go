@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	appModel "dating-app-backend/internal/model"
+)
+
+// TestListMatches checks that matches are listed newest first, a page at a
+// time, and that read ones can be left out.
+func TestListMatches(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+			ctx := context.Background()
+
+			me := newTestUser("me", "Male", 30, testLat, testLon)
+			older := newTestUser("older", "Female", 30, testLat, testLon)
+			middle := newTestUser("middle", "Female", 30, testLat, testLon)
+			newer := newTestUser("newer", "Female", 30, testLat, testLon)
+			outsider := newTestUser("outsider", "Female", 30, testLat, testLon)
+			createTestUsers(t, store, me, older, middle, newer, outsider)
+
+			// Each partner completes the match, so it is unread for me
+			now := time.Now().UTC()
+			matchIDs := make(map[string]string)
+			for i, partner := range []appModel.User{older, middle, newer} {
+				createdAt := now.Add(time.Duration(i) * time.Hour)
+				if _, _, err := store.RecordSwipe(ctx, appModel.Swipe{SwiperId: me.ID, SwipedId: partner.ID, Preference: appModel.SwipeYes, CreatedAt: createdAt}); err != nil {
+					t.Fatalf("RecordSwipe: %v", err)
+				}
+				matched, matchID, err := store.RecordSwipe(ctx, appModel.Swipe{SwiperId: partner.ID, SwipedId: me.ID, Preference: appModel.SwipeYes, CreatedAt: createdAt})
+				if err != nil || !matched {
+					t.Fatalf("RecordSwipe = %v, %v, want a match", matched, err)
+				}
+				matchIDs[partner.Name] = matchID
+			}
+
+			if err := store.MarkMatchRead(ctx, outsider.ID, matchIDs["middle"]); !errors.Is(err, ErrMatchNotFound) {
+				t.Errorf("MarkMatchRead by an outsider = %v, want %v", err, ErrMatchNotFound)
+			}
+			if err := store.MarkMatchRead(ctx, me.ID, matchIDs["middle"]); err != nil {
+				t.Fatalf("MarkMatchRead: %v", err)
+			}
+
+			// list pages through my matches and returns their partners' names
+			// and whether each is unread
+			list := func(opts ListMatchesOptions) (partners []string, unread []bool) {
+				t.Helper()
+				for pages := 0; ; pages++ {
+					if pages > len(matchIDs) {
+						t.Fatal("pagination does not end")
+					}
+					page, err := store.ListMatches(ctx, me.ID, opts)
+					if err != nil {
+						t.Fatalf("ListMatches: %v", err)
+					}
+					if len(page.Matches) > int(opts.Limit) {
+						t.Fatalf("page of %d matches, want at most %d", len(page.Matches), opts.Limit)
+					}
+					for _, match := range page.Matches {
+						for name, id := range matchIDs {
+							if id == match.ID {
+								partners = append(partners, name)
+							}
+						}
+						unread = append(unread, match.Unread)
+					}
+					if page.Next == "" {
+						return partners, unread
+					}
+					opts.Before = page.Next
+				}
+			}
+
+			tests := []struct {
+				name         string
+				opts         ListMatchesOptions
+				wantPartners []string
+				wantUnread   []bool
+			}{
+				{"all", ListMatchesOptions{Limit: 10}, []string{"newer", "middle", "older"}, []bool{true, false, true}},
+				{"all, paged", ListMatchesOptions{Limit: 2}, []string{"newer", "middle", "older"}, []bool{true, false, true}},
+				{"unread", ListMatchesOptions{Limit: 10, UnreadOnly: true}, []string{"newer", "older"}, []bool{true, true}},
+				{"unread, paged", ListMatchesOptions{Limit: 1, UnreadOnly: true}, []string{"newer", "older"}, []bool{true, true}},
+				{"before newer", ListMatchesOptions{Limit: 10, Before: matchIDs["newer"]}, []string{"middle", "older"}, []bool{false, true}},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					partners, unread := list(tt.opts)
+					if !slices.Equal(partners, tt.wantPartners) || !slices.Equal(unread, tt.wantUnread) {
+						t.Errorf("matches = %v, unread %v, want %v, unread %v", partners, unread, tt.wantPartners, tt.wantUnread)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+package storage
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	appConfig "dating-app-backend/internal/config"
+	appLogger "dating-app-backend/internal/logger"
+	appModel "dating-app-backend/internal/model"
+)
+
+// Memory keeps everything in process. It is meant for local development and
+// tests; nothing survives a restart.
+type Memory struct {
+	mu     sync.RWMutex
+	users  map[string]appModel.User
+	emails map[string]string
+	// swipes is keyed by swiper ID and then by swiped ID, like the Swipes table.
+	swipes          map[string]map[string]appModel.Swipe
+	recommendations map[string]map[string]float64
+	picks           map[string]dailyPicks
+	matches         map[string]appModel.Match
+	// matchIDs maps a pair of user IDs, as returned by appModel.MatchPair,
+	// to the ID of their match.
+	matchIDs map[[2]string]string
+	// unread holds the {user ID, match ID} pairs of unread matches.
+	unread map[[2]string]bool
+	// swipeResults is keyed by {user ID, idempotency key}.
+	swipeResults map[[2]string]SwipeResult
+	// superLikes is keyed by the ID of the super-liked user, oldest first.
+	superLikes map[string][]appModel.SuperLike
+	// superLikesSent counts each swiper's super-likes on the day of their
+	// latest one. Only that day's count is needed, so earlier days go.
+	superLikesSent   map[string]dailySuperLikes
+	superLikesPerDay int
+	// rankings holds discovery window rankings by user ID and ranking ID.
+	rankings map[string]map[string]windowRanking
+	radiusKm float64
+	logger   *appLogger.Logger
+}
+
+func NewMemory(cfg *appConfig.Config, logger *appLogger.Logger) *Memory {
+	logger.Info("Using in-memory storage")
+	return &Memory{
+		users:            make(map[string]appModel.User),
+		emails:           make(map[string]string),
+		swipes:           make(map[string]map[string]appModel.Swipe),
+		recommendations:  make(map[string]map[string]float64),
+		picks:            make(map[string]dailyPicks),
+		matches:          make(map[string]appModel.Match),
+		matchIDs:         make(map[[2]string]string),
+		unread:           make(map[[2]string]bool),
+		swipeResults:     make(map[[2]string]SwipeResult),
+		superLikes:       make(map[string][]appModel.SuperLike),
+		superLikesSent:   make(map[string]dailySuperLikes),
+		superLikesPerDay: cfg.SuperLikesPerDay,
+		rankings:         make(map[string]map[string]windowRanking),
+		radiusKm:         cfg.DiscoveryRadiusKm,
+		logger:           logger,
+	}
+}
+
+func (m *Memory) CreateUser(ctx context.Context, user appModel.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.putUser(user)
+
+	m.logger.Info("Successfully created user in memory", "userId", user.ID)
+	return nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (*appModel.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.emails[email]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user := m.users[id]
+	return &user, nil
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, userID string) (*appModel.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		m.logger.Warn("User not found", "userID", userID)
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, user *appModel.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.putUser(*user)
+	return nil
+}
+
+func (m *Memory) UpdatePreferences(ctx context.Context, userID string, prefs appModel.DiscoveryPreferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Preferences = prefs
+	m.users[userID] = user
+	return nil
+}
+
+func (m *Memory) SetDeactivated(ctx context.Context, userID string, deactivated bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Deactivated = deactivated
+	m.users[userID] = user
+	return nil
+}
+
+func (m *Memory) ScanUsers(ctx context.Context, fn func(users []appModel.User) error) error {
+	m.mu.RLock()
+	users := make([]appModel.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	m.mu.RUnlock()
+
+	if len(users) == 0 {
+		return nil
+	}
+	return fn(users)
+}
+
+func (m *Memory) UpdateAttractivenessScore(ctx context.Context, user appModel.User) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[user.ID]
+	if !ok {
+		return false, ErrUserNotFound
+	}
+	if stored.YesSwipes != user.YesSwipes || stored.TotalSwipes != user.TotalSwipes {
+		return false, nil
+	}
+	stored.AttractivenessScore = user.AttractivenessScore
+	m.users[user.ID] = stored
+	return true, nil
+}
+
+// putUser stores user and keeps the email index in step. Callers must hold mu.
+func (m *Memory) putUser(user appModel.User) {
+	if existing, ok := m.users[user.ID]; ok && existing.Email != user.Email {
+		delete(m.emails, existing.Email)
+	}
+	user.UpdateGeohash()
+	m.users[user.ID] = user
+	m.emails[user.Email] = user.ID
+}
+
+func (m *Memory) DiscoverUsers(ctx context.Context, currentUser appModel.User, opts DiscoverOptions) (DiscoverPage, error) {
+	m.logger.Info("Discovering users", "currentUserID", currentUser.ID, "limit", opts.Limit, "minAge", opts.MinAge, "maxAge", opts.MaxAge, "genders", opts.Genders, "maxDistanceKm", opts.MaxDistanceKm)
+
+	radiusKm := searchRadiusKm(opts, m.radiusKm)
+
+	page, err := discover(ctx, currentUser, opts, func(after *DistanceKey, n int) ([]appModel.User, error) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+
+		swiped := m.getSwipedUsers(currentUser.ID)
+		var users []appModel.User
+		for _, user := range m.users {
+			if matchesFilters(currentUser, user, swiped, opts) && distanceKm(currentUser, user) <= radiusKm && isAfter(currentUser, user, after) {
+				users = append(users, user)
+			}
+		}
+		return nearestUsers(currentUser, users, n), nil
+	}, m)
+	if err != nil {
+		return DiscoverPage{}, err
+	}
+
+	m.logger.Info("Users discovered successfully", "currentUserID", currentUser.ID, "count", len(page.Results))
+	return page, nil
+}
+
+// windowRanking is the ranking of a discovery window, stored at CreatedAt.
+type windowRanking struct {
+	IDs       []string
+	CreatedAt time.Time
+}
+
+func (m *Memory) putWindowRanking(ctx context.Context, userID, rankingID string, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Expired rankings are cleared out as the user stores new ones
+	rankings := m.rankings[userID]
+	if rankings == nil {
+		rankings = make(map[string]windowRanking)
+		m.rankings[userID] = rankings
+	}
+	maps.DeleteFunc(rankings, func(_ string, ranking windowRanking) bool {
+		return time.Since(ranking.CreatedAt) > WindowRankingTTL
+	})
+	rankings[rankingID] = windowRanking{IDs: slices.Clone(ids), CreatedAt: time.Now()}
+	return nil
+}
+
+func (m *Memory) getWindowRanking(ctx context.Context, userID, rankingID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ranking, ok := m.rankings[userID][rankingID]
+	if !ok || time.Since(ranking.CreatedAt) > WindowRankingTTL {
+		return nil, ErrRankingExpired
+	}
+	return ranking.IDs, nil
+}
+
+// getSwipedUsers returns the set of users swiperId has swiped on. Callers must
+// hold mu.
+func (m *Memory) getSwipedUsers(swiperId string) *seenSet {
+	swiped := make([]string, 0, len(m.swipes[swiperId]))
+	for swipedId := range m.swipes[swiperId] {
+		swiped = append(swiped, swipedId)
+	}
+	return newSeenSet(swiped)
+}
+
+func (m *Memory) RecordSwipe(ctx context.Context, swipe appModel.Swipe) (bool, string, error) {
+	m.logger.Info("Recording swipe", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "preference", swipe.Preference)
+
+	// The whole swipe is applied under one lock so that concurrent swipes on
+	// the same user cannot lose counter updates.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	swipedUser, ok := m.users[swipe.SwipedId]
+	if !ok {
+		m.logger.Error("Failed to get swiped user", "error", ErrUserNotFound, "swipedId", swipe.SwipedId)
+		return false, "", ErrUserNotFound
+	}
+	swiper, ok := m.users[swipe.SwiperId]
+	if !ok {
+		m.logger.Error("Failed to get swiper", "error", ErrUserNotFound, "swiperId", swipe.SwiperId)
+		return false, "", ErrUserNotFound
+	}
+
+	previous, repeat := m.swipes[swipe.SwiperId][swipe.SwipedId]
+	switch {
+	case !repeat:
+		swipedUser.TotalSwipes++
+		if swipe.Preference.Likes() {
+			swipedUser.YesSwipes++
+		}
+		swipedUser.UpdateAttractivenessScore()
+		swipedUser.UpdateRating(swiper.CurrentRating(), swipe.Preference)
+	case appModel.CanReviseSwipe(previous.Preference, swipe.Preference):
+		m.logger.Info("Revising swipe", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "from", previous.Preference)
+		swipedUser.ReviseSwipe()
+	default:
+		matched, matchID, err := m.repeatSwipeResult(previous)
+		if err != nil {
+			m.logger.Warn("Swipe between unmatched users", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
+			return false, "", err
+		}
+		m.logger.Info("Repeat swipe, returning the original result", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "matched", matched)
+		return matched, matchID, nil
+	}
+
+	if swipe.Preference == appModel.SwipeSuper {
+		sent := m.superLikesSent[swipe.SwiperId]
+		if day := superLikeDay(swipe.CreatedAt); sent.Day != day {
+			sent = dailySuperLikes{Day: day}
+		}
+		if sent.Used >= m.superLikesPerDay {
+			m.logger.Warn("Super-like quota exceeded", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
+			return false, "", ErrSuperLikeQuotaExceeded
+		}
+		sent.Used++
+		m.superLikesSent[swipe.SwiperId] = sent
+		received := dropExpiredSuperLikes(m.superLikes[swipe.SwipedId], swipe.CreatedAt)
+		m.superLikes[swipe.SwipedId] = append(received, appModel.SuperLike{
+			SwiperId:  swipe.SwiperId,
+			SwipedId:  swipe.SwipedId,
+			CreatedAt: swipe.CreatedAt,
+			Unread:    true,
+		})
+	}
+	m.users[swipedUser.ID] = swipedUser
+
+	if m.swipes[swipe.SwiperId] == nil {
+		m.swipes[swipe.SwiperId] = make(map[string]appModel.Swipe)
+	}
+	m.swipes[swipe.SwiperId][swipe.SwipedId] = swipe
+
+	if swipe.Preference.Likes() {
+		if matchSwipe, ok := m.swipes[swipe.SwipedId][swipe.SwiperId]; ok && matchSwipe.Preference.Likes() {
+			// A pair whose match was ended cannot match again
+			if match := m.putMatch(swipe); match.Active() {
+				m.logger.Info("Match found", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "matchId", match.ID)
+				return true, match.ID, nil
+			}
+		}
+	}
+
+	m.logger.Info("Swipe recorded successfully", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
+	return false, "", nil
+}
+
+func (m *Memory) ListSuperLikes(ctx context.Context, userID string, opts ListSuperLikesOptions) ([]appModel.SuperLike, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	received := m.superLikes[userID]
+	superLikes := make([]appModel.SuperLike, 0, min(len(received), MaxSuperLikes))
+	for i := len(received) - 1; i >= 0 && len(superLikes) < MaxSuperLikes; i-- {
+		if time.Since(received[i].CreatedAt) > SuperLikeTTL {
+			break
+		}
+		if opts.UnreadOnly && !received[i].Unread {
+			continue
+		}
+		superLikes = append(superLikes, received[i])
+	}
+	return superLikes, nil
+}
+
+func (m *Memory) MarkSuperLikesRead(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.superLikes[userID] {
+		m.superLikes[userID][i].Unread = false
+	}
+	return nil
+}
+
+// dailySuperLikes is how many super-likes a user has sent on Day.
+type dailySuperLikes struct {
+	Day  string
+	Used int
+}
+
+// dropExpiredSuperLikes removes the super-likes in received, oldest first,
+// that are older than SuperLikeTTL at now.
+func dropExpiredSuperLikes(received []appModel.SuperLike, now time.Time) []appModel.SuperLike {
+	expired := 0
+	for expired < len(received) && now.Sub(received[expired].CreatedAt) > SuperLikeTTL {
+		expired++
+	}
+	return slices.Delete(received, 0, expired)
+}
+
+func (m *Memory) GetSwipeResult(ctx context.Context, userID, key string) (SwipeResult, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result, ok := m.swipeResults[[2]string{userID, key}]
+	if !ok || result.expired() {
+		return SwipeResult{}, false, nil
+	}
+	return result, true, nil
+}
+
+func (m *Memory) PutSwipeResult(ctx context.Context, userID, key string, result SwipeResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.swipeResults[[2]string{userID, key}]; ok && !existing.expired() {
+		return nil
+	}
+	m.swipeResults[[2]string{userID, key}] = result
+	return nil
+}
+
+// repeatSwipeResult returns the result of previous, a swipe that is being
+// repeated: the pair's match, if it led to one. It fails with ErrUnmatched
+// if that match has been ended. Callers must hold mu.
+func (m *Memory) repeatSwipeResult(previous appModel.Swipe) (bool, string, error) {
+	if !previous.Preference.Likes() {
+		return false, "", nil
+	}
+	userAId, userBId := appModel.MatchPair(previous.SwiperId, previous.SwipedId)
+	id, ok := m.matchIDs[[2]string{userAId, userBId}]
+	if !ok {
+		return false, "", nil
+	}
+	if !m.matches[id].Active() {
+		return false, "", ErrUnmatched
+	}
+	return true, id, nil
+}
+
+// putMatch stores the match completed by swipe and returns it. If the pair
+// already has a match, that one is returned instead. Callers must hold mu.
+func (m *Memory) putMatch(swipe appModel.Swipe) appModel.Match {
+	userAId, userBId := appModel.MatchPair(swipe.SwiperId, swipe.SwipedId)
+	if id, ok := m.matchIDs[[2]string{userAId, userBId}]; ok {
+		return m.matches[id]
+	}
+
+	match := appModel.NewMatch(swipe.SwiperId, swipe.SwipedId, swipe.CreatedAt)
+	m.matches[match.ID] = match
+	m.matchIDs[[2]string{userAId, userBId}] = match.ID
+	m.unread[[2]string{swipe.SwipedId, match.ID}] = true
+	return match
+}
+
+func (m *Memory) ListMatches(ctx context.Context, userID string, opts ListMatchesOptions) (MatchPage, error) {
+	m.mu.RLock()
+	var matches []appModel.UserMatch
+	for _, match := range m.matches {
+		if !match.Active() || (match.UserAId != userID && match.UserBId != userID) {
+			continue
+		}
+		if opts.Before != "" && match.ID >= opts.Before {
+			continue
+		}
+		unread := m.unread[[2]string{userID, match.ID}]
+		if opts.UnreadOnly && !unread {
+			continue
+		}
+		matches = append(matches, appModel.UserMatch{Match: match, Unread: unread})
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ID > matches[j].ID
+	})
+	return matchPage(matches, opts.Limit), nil
+}
+
+func (m *Memory) MarkMatchRead(ctx context.Context, userID string, matchID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	match, ok := m.matches[matchID]
+	if !ok || !match.Active() || (match.UserAId != userID && match.UserBId != userID) {
+		return ErrMatchNotFound
+	}
+	delete(m.unread, [2]string{userID, matchID})
+	return nil
+}
+
+func (m *Memory) EndMatch(ctx context.Context, userID string, matchID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	match, ok := m.matches[matchID]
+	if !ok || !match.Active() || (match.UserAId != userID && match.UserBId != userID) {
+		return ErrMatchNotFound
+	}
+	match.Status = appModel.MatchEnded
+	m.matches[matchID] = match
+	delete(m.unread, [2]string{match.UserAId, matchID})
+	delete(m.unread, [2]string{match.UserBId, matchID})
+
+	m.logger.Info("Match ended", "userId", userID, "matchId", matchID)
+	return nil
+}
+
+func (m *Memory) ScanSwipes(ctx context.Context, fn func(swipes []appModel.Swipe) error) error {
+	m.mu.RLock()
+	var swipes []appModel.Swipe
+	for _, bySwiped := range m.swipes {
+		for _, swipe := range bySwiped {
+			swipes = append(swipes, swipe)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(swipes) == 0 {
+		return nil
+	}
+	return fn(swipes)
+}
+
+func (m *Memory) PutRecommendations(ctx context.Context, userID string, recommendations map[string]float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.recommendations[userID] = maps.Clone(recommendations)
+	return nil
+}
+
+func (m *Memory) GetRecommendations(ctx context.Context, userID string) (map[string]float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return maps.Clone(m.recommendations[userID]), nil
+}
+
+// dailyPicks are the picks a user was given on Day.
+type dailyPicks struct {
+	Day     string
+	PickIDs []string
+}
+
+func (m *Memory) GetPicks(ctx context.Context, currentUser appModel.User, day string) ([]appModel.UserPublicData, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.picks[currentUser.ID]
+	if !ok || stored.Day != day {
+		return nil, false, nil
+	}
+
+	swiped := m.getSwipedUsers(currentUser.ID)
+	var users []appModel.User
+	for _, id := range stored.PickIDs {
+		if user, ok := m.users[id]; ok && !swiped.Has(id) && user.Preferences.Visible() && !user.Deactivated {
+			users = append(users, user)
+		}
+	}
+	return toPublicUsers(currentUser, users), true, nil
+}
+
+func (m *Memory) PutPicks(ctx context.Context, userID string, day string, pickIDs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.picks[userID].Day != day {
+		m.picks[userID] = dailyPicks{Day: day, PickIDs: slices.Clone(pickIDs)}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE users (
+    id                   TEXT PRIMARY KEY,
+    email                TEXT NOT NULL,
+    password             TEXT NOT NULL,
+    name                 TEXT NOT NULL,
+    gender               TEXT NOT NULL,
+    age                  INTEGER NOT NULL,
+    latitude             DOUBLE PRECISION NOT NULL,
+    longitude            DOUBLE PRECISION NOT NULL,
+    location             GEOGRAPHY(Point, 4326)
+        GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography) STORED,
+    yes_swipes           INTEGER NOT NULL DEFAULT 0,
+    total_swipes         INTEGER NOT NULL DEFAULT 0,
+    attractiveness_score DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE INDEX users_email_idx ON users (email);
+CREATE INDEX users_location_idx ON users USING GIST (location);
+
+CREATE TABLE swipes (
+    swiper_id  TEXT NOT NULL,
+    swiped_id  TEXT NOT NULL,
+    preference TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (swiper_id, swiped_id)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN pref_min_age INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN pref_max_age INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN pref_genders TEXT NOT NULL DEFAULT '[]',
+    ADD COLUMN pref_max_distance_km DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN show_me BOOLEAN NOT NULL DEFAULT TRUE;
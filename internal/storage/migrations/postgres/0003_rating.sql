@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN rating DOUBLE PRECISION NOT NULL DEFAULT 1500;
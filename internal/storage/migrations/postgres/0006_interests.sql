@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN interests TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,10 @@
+CREATE TABLE matches (
+    id         TEXT PRIMARY KEY,
+    user_a_id  TEXT NOT NULL,
+    user_b_id  TEXT NOT NULL,
+    status     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (user_a_id, user_b_id)
+);
+
+CREATE INDEX matches_user_b_idx ON matches (user_b_id);
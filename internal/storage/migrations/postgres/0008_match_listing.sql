@@ -0,0 +1,7 @@
+ALTER TABLE matches
+    ADD COLUMN user_a_unread BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN user_b_unread BOOLEAN NOT NULL DEFAULT FALSE;
+
+DROP INDEX matches_user_b_idx;
+CREATE INDEX matches_user_a_listing_idx ON matches (user_a_id, id);
+CREATE INDEX matches_user_b_listing_idx ON matches (user_b_id, id);
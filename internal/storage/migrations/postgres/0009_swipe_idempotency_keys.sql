@@ -0,0 +1,10 @@
+CREATE TABLE swipe_idempotency_keys (
+    user_id         TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    swiped_id       TEXT NOT NULL,
+    preference      TEXT NOT NULL,
+    matched         BOOLEAN NOT NULL,
+    match_id        TEXT NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, idempotency_key)
+);
@@ -0,0 +1,24 @@
+CREATE TABLE users (
+    id                   TEXT PRIMARY KEY,
+    email                TEXT NOT NULL,
+    password             TEXT NOT NULL,
+    name                 TEXT NOT NULL,
+    gender               TEXT NOT NULL,
+    age                  INTEGER NOT NULL,
+    latitude             REAL NOT NULL,
+    longitude            REAL NOT NULL,
+    yes_swipes           INTEGER NOT NULL DEFAULT 0,
+    total_swipes         INTEGER NOT NULL DEFAULT 0,
+    attractiveness_score REAL NOT NULL DEFAULT 0
+);
+
+CREATE INDEX users_email_idx ON users (email);
+CREATE INDEX users_location_idx ON users (latitude, longitude);
+
+CREATE TABLE swipes (
+    swiper_id  TEXT NOT NULL,
+    swiped_id  TEXT NOT NULL,
+    preference TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (swiper_id, swiped_id)
+);
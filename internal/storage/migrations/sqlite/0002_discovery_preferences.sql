@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN pref_min_age INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN pref_max_age INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN pref_genders TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE users ADD COLUMN pref_max_distance_km REAL NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN show_me BOOLEAN NOT NULL DEFAULT TRUE;
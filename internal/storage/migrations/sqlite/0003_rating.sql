@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN rating REAL NOT NULL DEFAULT 1500;
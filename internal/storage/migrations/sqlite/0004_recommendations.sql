@@ -0,0 +1,6 @@
+CREATE TABLE recommendations (
+    user_id      TEXT NOT NULL,
+    candidate_id TEXT NOT NULL,
+    score        REAL NOT NULL,
+    PRIMARY KEY (user_id, candidate_id)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE picks (
+    user_id  TEXT PRIMARY KEY,
+    day      TEXT NOT NULL,
+    pick_ids TEXT NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE super_like_quotas (
+    user_id TEXT NOT NULL,
+    day     TEXT NOT NULL,
+    used    INTEGER NOT NULL,
+    PRIMARY KEY (user_id, day)
+);
+
+CREATE INDEX swipes_swiped_preference_idx ON swipes (swiped_id, preference, created_at);
@@ -0,0 +1 @@
+ALTER TABLE swipes ADD COLUMN unread BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,7 @@
+CREATE TABLE window_rankings (
+    user_id       TEXT NOT NULL,
+    ranking_id    TEXT NOT NULL,
+    candidate_ids TEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, ranking_id)
+);
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	appModel "dating-app-backend/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const picksTableName = "PicksTable"
+
+// picksItem holds a user's picks for Day. Each user has one item, which is
+// replaced when the picks for a new day are stored.
+type picksItem struct {
+	UserId  string   `dynamodbav:"UserId"`
+	Day     string   `dynamodbav:"Day"`
+	PickIds []string `dynamodbav:"PickIds"`
+}
+
+func (db *DynamoDB) createPicksTable() error {
+	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("UserId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("UserId"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		TableName:   aws.String(picksTableName),
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var resourceInUseErr *types.ResourceInUseException
+		if errors.As(err, &resourceInUseErr) {
+			db.logger.Warn("Picks table already exists")
+			return nil
+		}
+		db.logger.Error("Failed to create Picks table", "error", err)
+		return err
+	}
+	db.logger.Info("Successfully created Picks table")
+	return nil
+}
+
+func (db *DynamoDB) GetPicks(ctx context.Context, currentUser appModel.User, day string) ([]appModel.UserPublicData, bool, error) {
+	result, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(picksTableName),
+		Key: map[string]types.AttributeValue{
+			"UserId": &types.AttributeValueMemberS{Value: currentUser.ID},
+		},
+	})
+	if err != nil {
+		db.logger.Error("Failed to get picks from DynamoDB", "error", err, "userId", currentUser.ID)
+		return nil, false, err
+	}
+	if result.Item == nil {
+		return nil, false, nil
+	}
+
+	var item picksItem
+	if err := attributevalue.UnmarshalMap(result.Item, &item); err != nil {
+		db.logger.Error("Failed to unmarshal picks", "error", err, "userId", currentUser.ID)
+		return nil, false, err
+	}
+	if item.Day != day {
+		return nil, false, nil
+	}
+
+	seen, err := db.getSwipedUsers(ctx, currentUser.ID)
+	if err != nil {
+		db.logger.Error("Failed to get swiped users", "error", err, "userId", currentUser.ID)
+		return nil, false, err
+	}
+
+	var users []appModel.User
+	for _, id := range item.PickIds {
+		if seen.Has(id) {
+			continue
+		}
+		user, err := db.GetUserByID(ctx, id)
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if user.Preferences.Visible() && !user.Deactivated {
+			users = append(users, *user)
+		}
+	}
+	return toPublicUsers(currentUser, users), true, nil
+}
+
+func (db *DynamoDB) PutPicks(ctx context.Context, userID string, day string, pickIDs []string) error {
+	item, err := attributevalue.MarshalMap(picksItem{UserId: userID, Day: day, PickIds: pickIDs})
+	if err != nil {
+		db.logger.Error("Failed to marshal picks", "error", err, "userId", userID)
+		return err
+	}
+
+	_, err = db.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(picksTableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(UserId) OR #day <> :day"),
+		ExpressionAttributeNames: map[string]string{
+			"#day": "Day",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":day": &types.AttributeValueMemberS{Value: day},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	if err != nil {
+		db.logger.Error("Failed to put picks in DynamoDB", "error", err, "userId", userID)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	appModel "dating-app-backend/internal/model"
+)
+
+// TestGetPicksUnavailable checks that picks who hid themselves or
+// deactivated their account after the picks were stored are left out.
+func TestGetPicksUnavailable(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	showMe := false
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+			ctx := context.Background()
+			const day = "2024-01-02"
+
+			me := newTestUser("me", "Male", 30, testLat, testLon)
+			kept := newTestUser("kept", "Female", 30, testLat, testLon)
+			hidden := newTestUser("hidden", "Female", 30, testLat, testLon)
+			deactivated := newTestUser("deactivated", "Female", 30, testLat, testLon)
+			createTestUsers(t, store, me, kept, hidden, deactivated)
+
+			if err := store.PutPicks(ctx, me.ID, day, []string{hidden.ID, kept.ID, deactivated.ID}); err != nil {
+				t.Fatalf("PutPicks: %v", err)
+			}
+			if err := store.UpdatePreferences(ctx, hidden.ID, appModel.DiscoveryPreferences{Genders: []string{}, ShowMe: &showMe}); err != nil {
+				t.Fatalf("UpdatePreferences: %v", err)
+			}
+			if err := store.SetDeactivated(ctx, deactivated.ID, true); err != nil {
+				t.Fatalf("SetDeactivated: %v", err)
+			}
+
+			picks, ok, err := store.GetPicks(ctx, me, day)
+			if err != nil || !ok {
+				t.Fatalf("GetPicks = %v, %v", ok, err)
+			}
+			if len(picks) != 1 || picks[0].ID != kept.ID {
+				t.Errorf("picks = %+v, want only %s", picks, kept.ID)
+			}
+		})
+	}
+}
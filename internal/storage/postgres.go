@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	appConfig "dating-app-backend/internal/config"
+	"dating-app-backend/internal/geo"
+	appLogger "dating-app-backend/internal/logger"
+	appModel "dating-app-backend/internal/model"
+
+	_ "github.com/lib/pq"
+)
+
+// Postgres stores users and swipes in PostgreSQL. Discovery relies on the
+// PostGIS extension for radius queries.
+type Postgres struct {
+	*sqlStore
+}
+
+type postgresDialect struct{}
+
+// postgresCandidates selects the users that pass the discovery filters.
+var postgresCandidates = `SELECT ` + userColumns + `
+FROM users u
+WHERE u.id <> $1
+    AND NOT EXISTS (SELECT 1 FROM swipes s WHERE s.swiper_id = $1 AND s.swiped_id = u.id)
+    AND ST_DWithin(u.location, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography, $4)
+    AND ($5 = 0 OR u.age >= $5)
+    AND ($6 = 0 OR u.age <= $6)
+    AND ($7 = '' OR strpos($7, '|' || u.gender || '|') > 0)
+    AND u.show_me
+    AND NOT u.deactivated
+    AND (u.pref_min_age = 0 OR u.pref_min_age <= $8)
+    AND (u.pref_max_age = 0 OR u.pref_max_age >= $8)
+    AND (u.pref_genders = '[]' OR strpos(u.pref_genders, $9) > 0)
+    AND (u.pref_max_distance_km = 0
+        OR ST_DWithin(u.location, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography, u.pref_max_distance_km * 1000))`
+
+const postgresDistance = `ST_Distance(u.location, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography, false)`
+
+// postgresDiscoverQuery returns the nearest candidates past the band of
+// distances between $10 and $11 metres, and every candidate within it.
+var postgresDiscoverQuery = `(` + postgresCandidates + `
+    AND ` + postgresDistance + ` > $11
+ORDER BY u.location <-> ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography, u.id COLLATE "C"
+LIMIT $12)
+UNION ALL
+(` + postgresCandidates + `
+    AND ` + postgresDistance + ` BETWEEN $10 AND $11)`
+
+const (
+	// postgisSphereRadiusKm is the radius PostGIS measures sphere distances
+	// with, which differs from geo.EarthRadiusKm.
+	postgisSphereRadiusKm = 6371.0088
+	// keyDistanceMargin is the relative margin either side of the
+	// continuation key's distance within which PostGIS and geo.DistanceKm
+	// may disagree on which of two distances is the greater.
+	keyDistanceMargin = 1e-6
+)
+
+func NewPostgres(cfg *appConfig.Config, logger *appLogger.Logger) (*Postgres, error) {
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(context.TODO()); err != nil {
+		logger.Error("Failed to connect to Postgres", "error", err)
+		db.Close()
+		return nil, err
+	}
+
+	if err := migrate(context.TODO(), db, "migrations/postgres", logger); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Postgres{&sqlStore{db: db, dialect: postgresDialect{}, radiusKm: cfg.DiscoveryRadiusKm, superLikesPerDay: cfg.SuperLikesPerDay, logger: logger}}, nil
+}
+
+func (postgresDialect) name() string { return "Postgres" }
+
+func (postgresDialect) lockSuffix() string { return " FOR UPDATE" }
+
+func (postgresDialect) discoverRows(ctx context.Context, db *sql.DB, currentUser appModel.User, radiusKm float64, opts DiscoverOptions, after *DistanceKey, n int) (*sql.Rows, error) {
+	// PostGIS rounds distances differently, so the candidates around the
+	// key's distance, rescaled to PostGIS's sphere, are all returned for
+	// sqlStore to compare with the key itself. Any number of them may share
+	// the key's distance, so they cannot count towards n.
+	lowerMeters, upperMeters := -1.0, -1.0
+	if after != nil {
+		meters := after.Km * 1000 * postgisSphereRadiusKm / geo.EarthRadiusKm
+		lowerMeters, upperMeters = meters*(1-keyDistanceMargin), meters*(1+keyDistanceMargin)
+	}
+	return db.QueryContext(ctx, postgresDiscoverQuery,
+		currentUser.ID, currentUser.Longitude, currentUser.Latitude, radiusKm*1000,
+		opts.MinAge, opts.MaxAge, genderFilter(opts.Genders),
+		currentUser.Age, jsonString(currentUser.Gender), lowerMeters, upperMeters, n)
+}
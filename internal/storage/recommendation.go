@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	appModel "dating-app-backend/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const recommendationsTableName = "RecommendationsTable"
+
+// recommendationsItem is a user's whole candidate list. Lists are capped by
+// cmd/recommender, so they stay well within the item size limit.
+type recommendationsItem struct {
+	UserId     string             `dynamodbav:"UserId"`
+	Candidates map[string]float64 `dynamodbav:"Candidates"`
+}
+
+func (db *DynamoDB) createRecommendationsTable() error {
+	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("UserId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("UserId"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		TableName:   aws.String(recommendationsTableName),
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var resourceInUseErr *types.ResourceInUseException
+		if errors.As(err, &resourceInUseErr) {
+			db.logger.Warn("Recommendations table already exists")
+			return nil
+		}
+		db.logger.Error("Failed to create Recommendations table", "error", err)
+		return err
+	}
+	db.logger.Info("Successfully created Recommendations table")
+	return nil
+}
+
+func (db *DynamoDB) ScanSwipes(ctx context.Context, fn func(swipes []appModel.Swipe) error) error {
+	paginator := dynamodb.NewScanPaginator(db.client, &dynamodb.ScanInput{
+		TableName: aws.String(swipesTableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			db.logger.Error("Failed to scan swipes", "error", err)
+			return err
+		}
+		if len(page.Items) == 0 {
+			continue
+		}
+
+		var swipes []appModel.Swipe
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &swipes); err != nil {
+			db.logger.Error("Failed to unmarshal scanned swipes", "error", err)
+			return err
+		}
+		if err := fn(swipes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DynamoDB) PutRecommendations(ctx context.Context, userID string, recommendations map[string]float64) error {
+	if len(recommendations) == 0 {
+		_, err := db.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(recommendationsTableName),
+			Key: map[string]types.AttributeValue{
+				"UserId": &types.AttributeValueMemberS{Value: userID},
+			},
+		})
+		if err != nil {
+			db.logger.Error("Failed to delete recommendations", "error", err, "userId", userID)
+		}
+		return err
+	}
+
+	item, err := attributevalue.MarshalMap(recommendationsItem{UserId: userID, Candidates: recommendations})
+	if err != nil {
+		db.logger.Error("Failed to marshal recommendations", "error", err, "userId", userID)
+		return err
+	}
+
+	_, err = db.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(recommendationsTableName),
+		Item:      item,
+	})
+	if err != nil {
+		db.logger.Error("Failed to put recommendations in DynamoDB", "error", err, "userId", userID)
+		return err
+	}
+	return nil
+}
+
+func (db *DynamoDB) GetRecommendations(ctx context.Context, userID string) (map[string]float64, error) {
+	result, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(recommendationsTableName),
+		Key: map[string]types.AttributeValue{
+			"UserId": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		db.logger.Error("Failed to get recommendations from DynamoDB", "error", err, "userId", userID)
+		return nil, err
+	}
+
+	var item recommendationsItem
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &item); err != nil {
+			db.logger.Error("Failed to unmarshal recommendations", "error", err, "userId", userID)
+			return nil, err
+		}
+	}
+	if item.Candidates == nil {
+		item.Candidates = make(map[string]float64)
+	}
+	return item.Candidates, nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// seenCacheTTL bounds how stale a cached seen-set can get when swipes are
+	// recorded by another instance.
+	seenCacheTTL = time.Minute
+	// seenCacheMaxUsers bounds how many users' seen-sets are kept in memory.
+	seenCacheMaxUsers = 1000
+)
+
+// seenSet holds the IDs of the users someone has already swiped on. Discovery
+// checks candidates against it after fetching them, which keeps the storage
+// queries the same size however many swipes a user has made.
+type seenSet struct {
+	mu  sync.RWMutex
+	ids map[string]struct{}
+}
+
+func newSeenSet(ids []string) *seenSet {
+	set := &seenSet{ids: make(map[string]struct{}, len(ids))}
+	for _, id := range ids {
+		set.ids[id] = struct{}{}
+	}
+	return set
+}
+
+func (s *seenSet) Has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.ids[id]
+	return ok
+}
+
+func (s *seenSet) Add(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[id] = struct{}{}
+}
+
+type seenEntry struct {
+	set      *seenSet
+	loadedAt time.Time
+}
+
+// seenCache keeps recently used seen-sets so that paging through discovery
+// does not reload every swipe a user has made on each request.
+type seenCache struct {
+	mu      sync.Mutex
+	entries map[string]seenEntry
+}
+
+func newSeenCache() *seenCache {
+	return &seenCache{entries: make(map[string]seenEntry)}
+}
+
+func (c *seenCache) get(userID string) (*seenSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[userID]
+	if !ok || time.Since(entry.loadedAt) > seenCacheTTL {
+		return nil, false
+	}
+	return entry.set, true
+}
+
+func (c *seenCache) put(userID string, set *seenSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[userID]; !ok && len(c.entries) >= seenCacheMaxUsers {
+		c.evictOldest()
+	}
+	c.entries[userID] = seenEntry{set: set, loadedAt: time.Now()}
+}
+
+// add records a new swipe in swiperId's cached set, if there is one.
+func (c *seenCache) add(swiperId, swipedId string) {
+	c.mu.Lock()
+	entry, ok := c.entries[swiperId]
+	c.mu.Unlock()
+
+	if ok {
+		entry.set.Add(swipedId)
+	}
+}
+
+// evictOldest drops the entry that was loaded longest ago. Callers must hold
+// mu.
+func (c *seenCache) evictOldest() {
+	var oldestID string
+	var oldest time.Time
+	for id, entry := range c.entries {
+		if oldestID == "" || entry.loadedAt.Before(oldest) {
+			oldestID, oldest = id, entry.loadedAt
+		}
+	}
+	delete(c.entries, oldestID)
+}
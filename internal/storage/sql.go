@@ -0,0 +1,800 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	appLogger "dating-app-backend/internal/logger"
+	appModel "dating-app-backend/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlDialect covers what differs between the database/sql backends.
+type sqlDialect interface {
+	// name is used in log messages.
+	name() string
+	// lockSuffix is appended to a SELECT of a row that is about to be updated
+	// inside the same transaction.
+	lockSuffix() string
+	// discoverRows returns candidate users within radiusKm of currentUser that
+	// pass the age and gender filters and have not been swiped on yet,
+	// nearest first. It should also drop candidates whose own preferences
+	// reject currentUser; sqlStore rechecks all of them. It returns at least
+	// the first n candidates that come after after, and may return some that
+	// do not, which sqlStore drops.
+	discoverRows(ctx context.Context, db *sql.DB, currentUser appModel.User, radiusKm float64, opts DiscoverOptions, after *DistanceKey, n int) (*sql.Rows, error)
+}
+
+// sqlStore implements Storage on top of database/sql. Queries use $N
+// placeholders, which both lib/pq and SQLite understand. SQLite binds them
+// in order of first appearance, so $N must first appear in ascending order.
+type sqlStore struct {
+	db               *sql.DB
+	dialect          sqlDialect
+	radiusKm         float64
+	superLikesPerDay int
+	logger           *appLogger.Logger
+}
+
+var userColumnNames = []string{
+	"id", "email", "password", "name", "gender", "age", "latitude", "longitude",
+	"yes_swipes", "total_swipes", "attractiveness_score", "rating",
+	"pref_min_age", "pref_max_age", "pref_genders", "pref_max_distance_km", "show_me",
+	"interests", "deactivated",
+}
+
+var userColumns = strings.Join(userColumnNames, ", ")
+
+var upsertUserQuery = upsertQuery("users", userColumnNames, "id")
+
+// upsertQuery builds an INSERT that overwrites every column of an existing
+// row with the same key, like a DynamoDB PutItem.
+func upsertQuery(table string, columns []string, key string) string {
+	placeholders := make([]string, len(columns))
+	var updates []string
+	for i, column := range columns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		if column != key {
+			updates = append(updates, column+" = EXCLUDED."+column)
+		}
+	}
+	return "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ")\nVALUES (" + strings.Join(placeholders, ", ") +
+		")\nON CONFLICT (" + key + ") DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*appModel.User, error) {
+	var user appModel.User
+	var showMe bool
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.Gender, &user.Age,
+		&user.Latitude, &user.Longitude, &user.YesSwipes, &user.TotalSwipes, &user.AttractivenessScore, &user.Rating,
+		&user.Preferences.MinAge, &user.Preferences.MaxAge, (*stringList)(&user.Preferences.Genders),
+		&user.Preferences.MaxDistanceKm, &showMe, (*stringList)(&user.Interests), &user.Deactivated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.Preferences.ShowMe = &showMe
+	return &user, nil
+}
+
+func userValues(user *appModel.User) []any {
+	return []any{user.ID, user.Email, user.Password, user.Name, user.Gender, user.Age,
+		user.Latitude, user.Longitude, user.YesSwipes, user.TotalSwipes, user.AttractivenessScore, user.Rating,
+		user.Preferences.MinAge, user.Preferences.MaxAge, stringList(user.Preferences.Genders),
+		user.Preferences.MaxDistanceKm, user.Preferences.Visible(), stringList(user.Interests), user.Deactivated}
+}
+
+// stringList stores a []string as JSON in a TEXT column.
+type stringList []string
+
+func (l stringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	encoded, err := json.Marshal([]string(l))
+	return string(encoded), err
+}
+
+func (l *stringList) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	case []byte:
+		return json.Unmarshal(v, l)
+	default:
+		return fmt.Errorf("cannot scan %T into stringList", src)
+	}
+}
+
+// jsonString quotes s the way it appears inside a stringList column, so that
+// a substring search for it only matches whole elements.
+func jsonString(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
+
+// genderFilter encodes genders as "|Male|Female|" so that the discovery
+// queries can match a candidate's gender with a substring search. It is
+// empty when there is no filter.
+func genderFilter(genders []string) string {
+	if len(genders) == 0 {
+		return ""
+	}
+	return "|" + strings.Join(genders, "|") + "|"
+}
+
+func (s *sqlStore) CreateUser(ctx context.Context, user appModel.User) error {
+	user.UpdateGeohash()
+	if _, err := s.db.ExecContext(ctx, upsertUserQuery, userValues(&user)...); err != nil {
+		s.logger.Error("Failed to insert user in "+s.dialect.name(), "error", err, "userId", user.ID)
+		return err
+	}
+
+	s.logger.Info("Successfully created user in "+s.dialect.name(), "userId", user.ID)
+	return nil
+}
+
+func (s *sqlStore) GetUserByEmail(ctx context.Context, email string) (*appModel.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1 LIMIT 1`, email)
+	user, err := scanUser(row)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		s.logger.Error("Failed to query user by email", "error", err, "email", email)
+	}
+	return user, err
+}
+
+func (s *sqlStore) GetUserByID(ctx context.Context, userID string) (*appModel.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, userID)
+	user, err := scanUser(row)
+	if errors.Is(err, ErrUserNotFound) {
+		s.logger.Warn("User not found", "userID", userID)
+	} else if err != nil {
+		s.logger.Error("Failed to get user from "+s.dialect.name(), "error", err, "userID", userID)
+	}
+	return user, err
+}
+
+func (s *sqlStore) UpdateUser(ctx context.Context, user *appModel.User) error {
+	user.UpdateGeohash()
+	if _, err := s.db.ExecContext(ctx, upsertUserQuery, userValues(user)...); err != nil {
+		s.logger.Error("Failed to update user in "+s.dialect.name(), "error", err, "userId", user.ID)
+		return err
+	}
+	return nil
+}
+
+func (s *sqlStore) UpdatePreferences(ctx context.Context, userID string, prefs appModel.DiscoveryPreferences) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users
+SET pref_min_age = $1, pref_max_age = $2, pref_genders = $3, pref_max_distance_km = $4, show_me = $5
+WHERE id = $6`, prefs.MinAge, prefs.MaxAge, stringList(prefs.Genders), prefs.MaxDistanceKm, prefs.Visible(), userID)
+	if err != nil {
+		s.logger.Error("Failed to update preferences in "+s.dialect.name(), "error", err, "userId", userID)
+		return err
+	}
+	return userUpdated(result)
+}
+
+func (s *sqlStore) SetDeactivated(ctx context.Context, userID string, deactivated bool) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET deactivated = $1 WHERE id = $2`, deactivated, userID)
+	if err != nil {
+		s.logger.Error("Failed to set deactivated in "+s.dialect.name(), "error", err, "userId", userID)
+		return err
+	}
+	return userUpdated(result)
+}
+
+// userUpdated returns ErrUserNotFound if an UPDATE of one user by ID
+// matched no row.
+func userUpdated(result sql.Result) error {
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// scanUsersBatch is how many users ScanUsers reads per query. Each batch is
+// read in full before fn runs, so fn is free to write to the database.
+const scanUsersBatch = 500
+
+func (s *sqlStore) ScanUsers(ctx context.Context, fn func(users []appModel.User) error) error {
+	lastID := ""
+	for {
+		users, err := s.usersAfter(ctx, lastID, scanUsersBatch)
+		if err != nil {
+			s.logger.Error("Failed to scan users in "+s.dialect.name(), "error", err, "afterId", lastID)
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		if err := fn(users); err != nil {
+			return err
+		}
+		lastID = users[len(users)-1].ID
+	}
+}
+
+// usersAfter returns up to limit users with an ID greater than lastID, in ID
+// order.
+func (s *sqlStore) usersAfter(ctx context.Context, lastID string, limit int) ([]appModel.User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users WHERE id > $1 ORDER BY id LIMIT $2`, lastID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []appModel.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStore) UpdateAttractivenessScore(ctx context.Context, user appModel.User) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET attractiveness_score = $1 WHERE id = $2 AND yes_swipes = $3 AND total_swipes = $4`,
+		user.AttractivenessScore, user.ID, user.YesSwipes, user.TotalSwipes)
+	if err != nil {
+		s.logger.Error("Failed to update attractiveness score in "+s.dialect.name(), "error", err, "userId", user.ID)
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated > 0, nil
+}
+
+func (s *sqlStore) DiscoverUsers(ctx context.Context, currentUser appModel.User, opts DiscoverOptions) (DiscoverPage, error) {
+	s.logger.Info("Discovering users", "currentUserID", currentUser.ID, "limit", opts.Limit, "minAge", opts.MinAge, "maxAge", opts.MaxAge, "genders", opts.Genders, "maxDistanceKm", opts.MaxDistanceKm)
+
+	radiusKm := searchRadiusKm(opts, s.radiusKm)
+	page, err := discover(ctx, currentUser, opts, func(after *DistanceKey, n int) ([]appModel.User, error) {
+		rows, err := s.dialect.discoverRows(ctx, s.db, currentUser, radiusKm, opts, after, n)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var users []appModel.User
+		for rows.Next() {
+			user, err := scanUser(rows)
+			if err != nil {
+				return nil, err
+			}
+			if distanceKm(currentUser, *user) <= radiusKm && acceptsCurrentUser(currentUser, *user) && isAfter(currentUser, *user, after) {
+				users = append(users, *user)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nearestUsers(currentUser, users, n), nil
+	}, s)
+	if err != nil {
+		s.logger.Error("Failed to query users for discovery", "error", err, "currentUserID", currentUser.ID)
+		return DiscoverPage{}, err
+	}
+
+	s.logger.Info("Users discovered successfully", "currentUserID", currentUser.ID, "count", len(page.Results))
+	return page, nil
+}
+
+func (s *sqlStore) RecordSwipe(ctx context.Context, swipe appModel.Swipe) (bool, string, error) {
+	s.logger.Info("Recording swipe", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "preference", swipe.Preference)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, "", err
+	}
+	defer tx.Rollback()
+
+	// Lock the swiped user's row so concurrent swipes are counted one at a time.
+	swipedUser, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`+s.dialect.lockSuffix(), swipe.SwipedId))
+	if err != nil {
+		s.logger.Error("Failed to get swiped user", "error", err, "swipedId", swipe.SwipedId)
+		return false, "", err
+	}
+
+	var swiperRating float64
+	err = tx.QueryRowContext(ctx, `SELECT rating FROM users WHERE id = $1`, swipe.SwiperId).Scan(&swiperRating)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUserNotFound
+	}
+	if err != nil {
+		s.logger.Error("Failed to get swiper", "error", err, "swiperId", swipe.SwiperId)
+		return false, "", err
+	}
+
+	// The lock on the swiped user also keeps two of the same swipe from both
+	// being counted.
+	var previous string
+	err = tx.QueryRowContext(ctx, `SELECT preference FROM swipes WHERE swiper_id = $1 AND swiped_id = $2`,
+		swipe.SwiperId, swipe.SwipedId).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("Failed to check for earlier swipe", "error", err)
+		return false, "", err
+	}
+	repeat := err == nil
+
+	switch {
+	case !repeat:
+		swipedUser.TotalSwipes++
+		if swipe.Preference.Likes() {
+			swipedUser.YesSwipes++
+		}
+		swipedUser.UpdateAttractivenessScore()
+		swipedUser.UpdateRating(swiperRating, swipe.Preference)
+	case appModel.CanReviseSwipe(appModel.SwipePreference(previous), swipe.Preference):
+		s.logger.Info("Revising swipe", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "from", previous)
+		swipedUser.ReviseSwipe()
+	default:
+		matched, matchID, err := repeatSwipeResult(ctx, tx, swipe, appModel.SwipePreference(previous))
+		if errors.Is(err, ErrUnmatched) {
+			s.logger.Warn("Swipe between unmatched users", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
+			return false, "", err
+		}
+		if err != nil {
+			s.logger.Error("Failed to get existing match", "error", err)
+			return false, "", err
+		}
+		s.logger.Info("Repeat swipe, returning the original result", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "matched", matched)
+		return matched, matchID, nil
+	}
+
+	if swipe.Preference == appModel.SwipeSuper {
+		if err := s.useSuperLike(ctx, tx, swipe); err != nil {
+			if errors.Is(err, ErrSuperLikeQuotaExceeded) {
+				s.logger.Warn("Super-like quota exceeded", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
+			} else {
+				s.logger.Error("Failed to use super-like", "error", err, "swiperId", swipe.SwiperId)
+			}
+			return false, "", err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET yes_swipes = $1, total_swipes = $2, attractiveness_score = $3, rating = $4 WHERE id = $5`,
+		swipedUser.YesSwipes, swipedUser.TotalSwipes, swipedUser.AttractivenessScore, swipedUser.Rating, swipedUser.ID)
+	if err != nil {
+		s.logger.Error("Failed to update swiped user", "error", err, "swipedId", swipe.SwipedId)
+		return false, "", err
+	}
+
+	// A super-like is unread for the swiped user until they mark it read
+	_, err = tx.ExecContext(ctx, `INSERT INTO swipes (swiper_id, swiped_id, preference, created_at, unread)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (swiper_id, swiped_id) DO UPDATE SET preference = EXCLUDED.preference, created_at = EXCLUDED.created_at, unread = EXCLUDED.unread`,
+		swipe.SwiperId, swipe.SwipedId, string(swipe.Preference), swipe.CreatedAt, swipe.Preference == appModel.SwipeSuper)
+	if err != nil {
+		s.logger.Error("Failed to insert swipe in "+s.dialect.name(), "error", err)
+		return false, "", err
+	}
+
+	matched, matchID := false, ""
+	if swipe.Preference.Likes() {
+		var preference string
+		err = tx.QueryRowContext(ctx, `SELECT preference FROM swipes WHERE swiper_id = $1 AND swiped_id = $2`,
+			swipe.SwipedId, swipe.SwiperId).Scan(&preference)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("Failed to check for match", "error", err)
+			return false, "", err
+		}
+		matched = appModel.SwipePreference(preference).Likes()
+	}
+
+	if matched {
+		var status appModel.MatchStatus
+		if matchID, status, err = putMatch(ctx, tx, swipe); err != nil {
+			s.logger.Error("Failed to insert match in "+s.dialect.name(), "error", err)
+			return false, "", err
+		}
+		// A pair whose match was ended cannot match again
+		matched = status == appModel.MatchActive
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Failed to commit swipe", "error", err)
+		return false, "", err
+	}
+
+	if matched {
+		s.logger.Info("Match found", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "matchId", matchID)
+		return true, matchID, nil
+	}
+
+	s.logger.Info("Swipe recorded successfully", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
+	return false, "", nil
+}
+
+// useSuperLike counts swipe against the swiper's super-likes for the day
+// inside tx, or fails with ErrSuperLikeQuotaExceeded if none are left. The
+// count is checked by the upsert itself, so concurrent swipes cannot both
+// take the last one.
+func (s *sqlStore) useSuperLike(ctx context.Context, tx *sql.Tx, swipe appModel.Swipe) error {
+	if s.superLikesPerDay <= 0 {
+		return ErrSuperLikeQuotaExceeded
+	}
+	day := superLikeDay(swipe.CreatedAt)
+
+	// Only the day's count is needed, so earlier days are cleared out as the
+	// user sends new super-likes
+	_, err := tx.ExecContext(ctx, `DELETE FROM super_like_quotas WHERE user_id = $1 AND day < $2`, swipe.SwiperId, day)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO super_like_quotas (user_id, day, used)
+VALUES ($1, $2, 1)
+ON CONFLICT (user_id, day) DO UPDATE SET used = super_like_quotas.used + 1 WHERE super_like_quotas.used < $3`,
+		swipe.SwiperId, day, s.superLikesPerDay)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSuperLikeQuotaExceeded
+	}
+	return nil
+}
+
+func (s *sqlStore) ListSuperLikes(ctx context.Context, userID string, opts ListSuperLikesOptions) ([]appModel.SuperLike, error) {
+	// Super-likes are kept as swipes, so older ones stay but are not listed
+	rows, err := s.db.QueryContext(ctx, `SELECT swiper_id, created_at, unread FROM swipes
+WHERE swiped_id = $1 AND preference = $2 AND created_at > $3
+AND (NOT $4 OR unread)
+ORDER BY created_at DESC
+LIMIT $5`, userID, string(appModel.SwipeSuper), time.Now().UTC().Add(-SuperLikeTTL), opts.UnreadOnly, MaxSuperLikes)
+	if err != nil {
+		s.logger.Error("Failed to list super-likes in "+s.dialect.name(), "error", err, "userId", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var superLikes []appModel.SuperLike
+	for rows.Next() {
+		superLike := appModel.SuperLike{SwipedId: userID}
+		if err := rows.Scan(&superLike.SwiperId, &superLike.CreatedAt, &superLike.Unread); err != nil {
+			return nil, err
+		}
+		superLikes = append(superLikes, superLike)
+	}
+	return superLikes, rows.Err()
+}
+
+func (s *sqlStore) MarkSuperLikesRead(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE swipes SET unread = FALSE WHERE swiped_id = $1 AND unread`, userID)
+	if err != nil {
+		s.logger.Error("Failed to mark super-likes read in "+s.dialect.name(), "error", err, "userId", userID)
+		return err
+	}
+	return nil
+}
+
+func (s *sqlStore) putWindowRanking(ctx context.Context, userID, rankingID string, ids []string) error {
+	// Expired rankings are cleared out as the user stores new ones
+	_, err := s.db.ExecContext(ctx, `DELETE FROM window_rankings WHERE user_id = $1 AND created_at <= $2`,
+		userID, time.Now().UTC().Add(-WindowRankingTTL))
+	if err != nil {
+		s.logger.Error("Failed to clear expired window rankings in "+s.dialect.name(), "error", err, "userId", userID)
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO window_rankings (user_id, ranking_id, candidate_ids, created_at) VALUES ($1, $2, $3, $4)`,
+		userID, rankingID, stringList(ids), time.Now().UTC())
+	if err != nil {
+		s.logger.Error("Failed to put window ranking in "+s.dialect.name(), "error", err, "userId", userID)
+		return err
+	}
+	return nil
+}
+
+func (s *sqlStore) getWindowRanking(ctx context.Context, userID, rankingID string) ([]string, error) {
+	var ids stringList
+	err := s.db.QueryRowContext(ctx, `SELECT candidate_ids FROM window_rankings
+WHERE user_id = $1 AND ranking_id = $2 AND created_at > $3`,
+		userID, rankingID, time.Now().UTC().Add(-WindowRankingTTL)).Scan(&ids)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRankingExpired
+	}
+	if err != nil {
+		s.logger.Error("Failed to get window ranking from "+s.dialect.name(), "error", err, "userId", userID)
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (s *sqlStore) GetSwipeResult(ctx context.Context, userID, key string) (SwipeResult, bool, error) {
+	var result SwipeResult
+	err := s.db.QueryRowContext(ctx, `SELECT swiped_id, preference, matched, match_id, created_at FROM swipe_idempotency_keys
+WHERE user_id = $1 AND idempotency_key = $2 AND created_at > $3`,
+		userID, key, time.Now().UTC().Add(-IdempotencyKeyTTL)).Scan(&result.SwipedId, &result.Preference, &result.Matched, &result.MatchId, &result.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SwipeResult{}, false, nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to get swipe result in "+s.dialect.name(), "error", err, "userId", userID)
+		return SwipeResult{}, false, err
+	}
+	return result, true, nil
+}
+
+func (s *sqlStore) PutSwipeResult(ctx context.Context, userID, key string, result SwipeResult) error {
+	// Expired keys are cleared out as the user sends new ones
+	_, err := s.db.ExecContext(ctx, `DELETE FROM swipe_idempotency_keys WHERE user_id = $1 AND created_at <= $2`,
+		userID, time.Now().UTC().Add(-IdempotencyKeyTTL))
+	if err != nil {
+		s.logger.Error("Failed to clear expired swipe results in "+s.dialect.name(), "error", err, "userId", userID)
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO swipe_idempotency_keys (user_id, idempotency_key, swiped_id, preference, matched, match_id, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (user_id, idempotency_key) DO NOTHING`,
+		userID, key, result.SwipedId, string(result.Preference), result.Matched, result.MatchId, result.CreatedAt)
+	if err != nil {
+		s.logger.Error("Failed to put swipe result in "+s.dialect.name(), "error", err, "userId", userID)
+		return err
+	}
+	return nil
+}
+
+// repeatSwipeResult returns the result of the swiper's earlier swipe on the
+// same user, which had preference previous: the pair's match, if it led to
+// one. It fails with ErrUnmatched if that match has been ended.
+func repeatSwipeResult(ctx context.Context, tx *sql.Tx, swipe appModel.Swipe, previous appModel.SwipePreference) (bool, string, error) {
+	if !previous.Likes() {
+		return false, "", nil
+	}
+
+	userAId, userBId := appModel.MatchPair(swipe.SwiperId, swipe.SwipedId)
+	var matchID, status string
+	err := tx.QueryRowContext(ctx, `SELECT id, status FROM matches WHERE user_a_id = $1 AND user_b_id = $2`,
+		userAId, userBId).Scan(&matchID, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if appModel.MatchStatus(status) != appModel.MatchActive {
+		return false, "", ErrUnmatched
+	}
+	return true, matchID, nil
+}
+
+// putMatch stores the match completed by swipe inside tx and returns its ID
+// and status. If the pair already has a match, that one's are returned
+// instead.
+func putMatch(ctx context.Context, tx *sql.Tx, swipe appModel.Swipe) (string, appModel.MatchStatus, error) {
+	match := appModel.NewMatch(swipe.SwiperId, swipe.SwipedId, swipe.CreatedAt)
+	_, err := tx.ExecContext(ctx, `INSERT INTO matches (id, user_a_id, user_b_id, status, created_at, user_a_unread, user_b_unread)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (user_a_id, user_b_id) DO NOTHING`,
+		match.ID, match.UserAId, match.UserBId, string(match.Status), match.CreatedAt,
+		match.UserAId == swipe.SwipedId, match.UserBId == swipe.SwipedId)
+	if err != nil {
+		return "", "", err
+	}
+
+	var matchID, status string
+	err = tx.QueryRowContext(ctx, `SELECT id, status FROM matches WHERE user_a_id = $1 AND user_b_id = $2`,
+		match.UserAId, match.UserBId).Scan(&matchID, &status)
+	return matchID, appModel.MatchStatus(status), err
+}
+
+// scanSwipesBatch is how many swipes ScanSwipes reads per query.
+const scanSwipesBatch = 1000
+
+func (s *sqlStore) ScanSwipes(ctx context.Context, fn func(swipes []appModel.Swipe) error) error {
+	var last appModel.Swipe
+	for {
+		swipes, err := s.swipesAfter(ctx, last.SwiperId, last.SwipedId, scanSwipesBatch)
+		if err != nil {
+			s.logger.Error("Failed to scan swipes in "+s.dialect.name(), "error", err, "afterSwiperId", last.SwiperId)
+			return err
+		}
+		if len(swipes) == 0 {
+			return nil
+		}
+		if err := fn(swipes); err != nil {
+			return err
+		}
+		last = swipes[len(swipes)-1]
+	}
+}
+
+// swipesAfter returns up to limit swipes that come after (swiperID, swipedID)
+// in key order.
+func (s *sqlStore) swipesAfter(ctx context.Context, swiperID, swipedID string, limit int) ([]appModel.Swipe, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT swiper_id, swiped_id, preference, created_at FROM swipes
+WHERE swiper_id > $1 OR (swiper_id = $1 AND swiped_id > $2)
+ORDER BY swiper_id, swiped_id
+LIMIT $3`, swiperID, swipedID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var swipes []appModel.Swipe
+	for rows.Next() {
+		var swipe appModel.Swipe
+		if err := rows.Scan(&swipe.SwiperId, &swipe.SwipedId, &swipe.Preference, &swipe.CreatedAt); err != nil {
+			return nil, err
+		}
+		swipes = append(swipes, swipe)
+	}
+	return swipes, rows.Err()
+}
+
+func (s *sqlStore) PutRecommendations(ctx context.Context, userID string, recommendations map[string]float64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recommendations WHERE user_id = $1`, userID); err != nil {
+		s.logger.Error("Failed to clear recommendations in "+s.dialect.name(), "error", err, "userId", userID)
+		return err
+	}
+	for candidateID, score := range recommendations {
+		_, err := tx.ExecContext(ctx, `INSERT INTO recommendations (user_id, candidate_id, score) VALUES ($1, $2, $3)`,
+			userID, candidateID, score)
+		if err != nil {
+			s.logger.Error("Failed to insert recommendation in "+s.dialect.name(), "error", err, "userId", userID)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetRecommendations(ctx context.Context, userID string) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT candidate_id, score FROM recommendations WHERE user_id = $1`, userID)
+	if err != nil {
+		s.logger.Error("Failed to get recommendations from "+s.dialect.name(), "error", err, "userId", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	recommendations := make(map[string]float64)
+	for rows.Next() {
+		var candidateID string
+		var score float64
+		if err := rows.Scan(&candidateID, &score); err != nil {
+			return nil, err
+		}
+		recommendations[candidateID] = score
+	}
+	return recommendations, rows.Err()
+}
+
+func (s *sqlStore) GetPicks(ctx context.Context, currentUser appModel.User, day string) ([]appModel.UserPublicData, bool, error) {
+	var storedDay string
+	var pickIDs []string
+	err := s.db.QueryRowContext(ctx, `SELECT day, pick_ids FROM picks WHERE user_id = $1`, currentUser.ID).
+		Scan(&storedDay, (*stringList)(&pickIDs))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && storedDay != day) {
+		return nil, false, nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to get picks from "+s.dialect.name(), "error", err, "userId", currentUser.ID)
+		return nil, false, err
+	}
+
+	var users []appModel.User
+	for _, id := range pickIDs {
+		user, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users
+WHERE id = $1 AND show_me AND NOT deactivated
+AND NOT EXISTS (SELECT 1 FROM swipes WHERE swiper_id = $2 AND swiped_id = users.id)`, id, currentUser.ID))
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			s.logger.Error("Failed to get pick from "+s.dialect.name(), "error", err, "userId", currentUser.ID, "pickId", id)
+			return nil, false, err
+		}
+		users = append(users, *user)
+	}
+	return toPublicUsers(currentUser, users), true, nil
+}
+
+func (s *sqlStore) PutPicks(ctx context.Context, userID string, day string, pickIDs []string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO picks (user_id, day, pick_ids) VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE SET day = EXCLUDED.day, pick_ids = EXCLUDED.pick_ids
+WHERE picks.day <> EXCLUDED.day`, userID, day, stringList(pickIDs))
+	if err != nil {
+		s.logger.Error("Failed to put picks in "+s.dialect.name(), "error", err, "userId", userID)
+	}
+	return err
+}
+
+func (s *sqlStore) ListMatches(ctx context.Context, userID string, opts ListMatchesOptions) (MatchPage, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_a_id, user_b_id, status, created_at,
+CASE WHEN user_a_id = $1 THEN user_a_unread ELSE user_b_unread END AS unread
+FROM matches
+WHERE (user_a_id = $1 OR user_b_id = $1) AND ($2 = '' OR id < $2)
+AND (NOT $3 OR CASE WHEN user_a_id = $1 THEN user_a_unread ELSE user_b_unread END)
+AND status = $4
+ORDER BY id DESC
+LIMIT $5`, userID, opts.Before, opts.UnreadOnly, string(appModel.MatchActive), opts.Limit+1)
+	if err != nil {
+		s.logger.Error("Failed to list matches in "+s.dialect.name(), "error", err, "userId", userID)
+		return MatchPage{}, err
+	}
+	defer rows.Close()
+
+	var matches []appModel.UserMatch
+	for rows.Next() {
+		var match appModel.UserMatch
+		err := rows.Scan(&match.ID, &match.UserAId, &match.UserBId, &match.Status, &match.CreatedAt, &match.Unread)
+		if err != nil {
+			return MatchPage{}, err
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return MatchPage{}, err
+	}
+	return matchPage(matches, opts.Limit), nil
+}
+
+func (s *sqlStore) MarkMatchRead(ctx context.Context, userID string, matchID string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE matches
+SET user_a_unread = CASE WHEN user_a_id = $1 THEN FALSE ELSE user_a_unread END,
+    user_b_unread = CASE WHEN user_b_id = $1 THEN FALSE ELSE user_b_unread END
+WHERE id = $2 AND (user_a_id = $1 OR user_b_id = $1) AND status = $3`, userID, matchID, string(appModel.MatchActive))
+	if err != nil {
+		s.logger.Error("Failed to mark match read in "+s.dialect.name(), "error", err, "userId", userID, "matchId", matchID)
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrMatchNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) EndMatch(ctx context.Context, userID string, matchID string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE matches
+SET status = $1, user_a_unread = FALSE, user_b_unread = FALSE
+WHERE id = $2 AND (user_a_id = $3 OR user_b_id = $3) AND status = $4`,
+		string(appModel.MatchEnded), matchID, userID, string(appModel.MatchActive))
+	if err != nil {
+		s.logger.Error("Failed to end match in "+s.dialect.name(), "error", err, "userId", userID, "matchId", matchID)
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrMatchNotFound
+	}
+
+	s.logger.Info("Match ended", "userId", userID, "matchId", matchID)
+	return nil
+}
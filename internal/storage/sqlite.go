@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	appConfig "dating-app-backend/internal/config"
+	"dating-app-backend/internal/geo"
+	appLogger "dating-app-backend/internal/logger"
+	appModel "dating-app-backend/internal/model"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLite stores users and swipes in a single SQLite file. It suits
+// single-node deployments and tests that should not need Docker.
+type SQLite struct {
+	*sqlStore
+}
+
+type sqliteDialect struct{}
+
+// sqliteDriverName is the go-sqlite3 driver with distance_km registered on
+// every connection. It is geo.DistanceKm itself, so the database orders
+// candidates exactly as DistanceKey does.
+const sqliteDriverName = "sqlite3_geo"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("distance_km", geo.DistanceKm, true)
+		},
+	})
+}
+
+// SQLite has no spatial index, so discovery narrows candidates with a
+// bounding box on the (latitude, longitude) index before measuring their
+// distance.
+var sqliteDiscoverQuery = `SELECT ` + userColumns + `
+FROM users u
+WHERE u.id <> $1
+    AND NOT EXISTS (SELECT 1 FROM swipes s WHERE s.swiper_id = $1 AND s.swiped_id = u.id)
+    AND u.latitude BETWEEN $2 AND $3
+    AND u.longitude BETWEEN $4 AND $5
+    AND ($6 = 0 OR u.age >= $6)
+    AND ($7 = 0 OR u.age <= $7)
+    AND ($8 = '' OR instr($8, '|' || u.gender || '|') > 0)
+    AND u.show_me
+    AND NOT u.deactivated
+    AND (u.pref_min_age = 0 OR u.pref_min_age <= $9)
+    AND (u.pref_max_age = 0 OR u.pref_max_age >= $9)
+    AND (u.pref_genders = '[]' OR instr(u.pref_genders, $10) > 0)
+    AND distance_km($11, $12, u.latitude, u.longitude) <= $13
+    AND (u.pref_max_distance_km = 0 OR distance_km($11, $12, u.latitude, u.longitude) <= u.pref_max_distance_km)
+    AND ($14 = '' OR distance_km($11, $12, u.latitude, u.longitude) > $15
+        OR (distance_km($11, $12, u.latitude, u.longitude) = $15 AND u.id > $14))
+ORDER BY distance_km($11, $12, u.latitude, u.longitude), u.id
+LIMIT $16`
+
+func NewSQLite(cfg *appConfig.Config, logger *appLogger.Logger) (*SQLite, error) {
+	// _txlock=immediate takes the write lock when a transaction starts, which
+	// is what lockSuffix relies on in place of SELECT ... FOR UPDATE.
+	db, err := sql.Open(sqliteDriverName, "file:"+cfg.SQLitePath+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps ":memory:" databases shared and avoids
+	// SQLITE_BUSY between our own connections.
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(context.TODO(), db, "migrations/sqlite", logger); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLite{&sqlStore{db: db, dialect: sqliteDialect{}, radiusKm: cfg.DiscoveryRadiusKm, superLikesPerDay: cfg.SuperLikesPerDay, logger: logger}}, nil
+}
+
+func (sqliteDialect) name() string { return "SQLite" }
+
+func (sqliteDialect) lockSuffix() string { return "" }
+
+func (sqliteDialect) discoverRows(ctx context.Context, db *sql.DB, currentUser appModel.User, radiusKm float64, opts DiscoverOptions, after *DistanceKey, n int) (*sql.Rows, error) {
+	minLat, maxLat, minLon, maxLon := geo.BoundingBox(currentUser.Latitude, currentUser.Longitude, radiusKm)
+	var afterID string
+	var afterKm float64
+	if after != nil {
+		afterID, afterKm = after.ID, after.Km
+	}
+	return db.QueryContext(ctx, sqliteDiscoverQuery,
+		currentUser.ID, minLat, maxLat, minLon, maxLon,
+		opts.MinAge, opts.MaxAge, genderFilter(opts.Genders), currentUser.Age, jsonString(currentUser.Gender),
+		currentUser.Latitude, currentUser.Longitude, radiusKm, afterID, afterKm, n)
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"dating-app-backend/internal/geo"
+	appModel "dating-app-backend/internal/model"
+)
+
+// newTestSQLite opens a migrated SQLite database in a temporary file.
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	cfg := testConfig()
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "test.db")
+	store, err := NewSQLite(cfg, testLogger())
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { store.db.Close() })
+	return store
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	cfg := testConfig()
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "test.db")
+	store, err := NewSQLite(cfg, testLogger())
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+
+	var applied int
+	if err := store.db.QueryRow(`SELECT count(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatalf("count migrations: %v", err)
+	}
+	entries, err := migrationsFS.ReadDir("migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(entries) {
+		t.Errorf("applied %d migrations, want %d", applied, len(entries))
+	}
+
+	// Reopening the file applies nothing twice and keeps the data
+	user := newTestUser("alice", "Female", 30, testLat, testLon)
+	createTestUsers(t, store, user)
+	store.db.Close()
+
+	store, err = NewSQLite(cfg, testLogger())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.db.Close()
+	got, err := store.GetUserByEmail(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail after reopening: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("GetUserByEmail after reopening = %s, want %s", got.ID, user.ID)
+	}
+}
+
+func TestSQLiteDiscoverFilters(t *testing.T) {
+	store := newTestSQLite(t)
+
+	me := newTestUser("me", "Male", 30, testLat, testLon)
+	createTestUsers(t, store, me,
+		newTestUser("woman25", "Female", 25, testLat+0.01, testLon),
+		newTestUser("man30", "Male", 30, testLat+0.02, testLon),
+		newTestUser("woman40", "Female", 40, testLat+0.03, testLon),
+	)
+
+	tests := []struct {
+		name string
+		opts DiscoverOptions
+		want []string
+	}{
+		{"no filters", DiscoverOptions{}, []string{"woman25", "man30", "woman40"}},
+		{"min age", DiscoverOptions{MinAge: 30}, []string{"man30", "woman40"}},
+		{"max age", DiscoverOptions{MaxAge: 30}, []string{"woman25", "man30"}},
+		{"age range", DiscoverOptions{MinAge: 26, MaxAge: 35}, []string{"man30"}},
+		{"gender", DiscoverOptions{Genders: []string{"Female"}}, []string{"woman25", "woman40"}},
+		{"genders", DiscoverOptions{Genders: []string{"Female", "Male"}}, []string{"woman25", "man30", "woman40"}},
+		{"gender and age", DiscoverOptions{Genders: []string{"Female"}, MinAge: 30}, []string{"woman40"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discoveredNames(t, store, me, tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("discovered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteSwipeExclusion(t *testing.T) {
+	store := newTestSQLite(t)
+	ctx := context.Background()
+
+	me := newTestUser("me", "Male", 30, testLat, testLon)
+	liked := newTestUser("liked", "Female", 30, testLat+0.01, testLon)
+	passed := newTestUser("passed", "Female", 30, testLat+0.02, testLon)
+	other := newTestUser("other", "Female", 30, testLat+0.03, testLon)
+	createTestUsers(t, store, me, liked, passed, other)
+
+	for _, swipe := range []appModel.Swipe{
+		{SwiperId: me.ID, SwipedId: liked.ID, Preference: appModel.SwipeYes, CreatedAt: time.Now().UTC()},
+		{SwiperId: me.ID, SwipedId: passed.ID, Preference: appModel.SwipeNo, CreatedAt: time.Now().UTC()},
+		// Being swiped on does not hide a user from the swiped user
+		{SwiperId: other.ID, SwipedId: me.ID, Preference: appModel.SwipeYes, CreatedAt: time.Now().UTC()},
+	} {
+		if _, _, err := store.RecordSwipe(ctx, swipe); err != nil {
+			t.Fatalf("RecordSwipe: %v", err)
+		}
+	}
+
+	if got, want := discoveredNames(t, store, me, DiscoverOptions{}), []string{"other"}; !slices.Equal(got, want) {
+		t.Errorf("discovered %v, want %v", got, want)
+	}
+}
+
+func TestSQLiteDiscoverRadius(t *testing.T) {
+	store := newTestSQLite(t)
+	radiusKm := testConfig().DiscoveryRadiusKm
+
+	me := newTestUser("me", "Male", 30, testLat, testLon)
+	near := newTestUser("near", "Female", 30, testLat+0.09, testLon)
+	// Inside the bounding box the query narrows candidates with, but in its
+	// corner, beyond the radius
+	corner := newTestUser("corner", "Female", 30, testLat+0.4, testLon+0.6)
+	far := newTestUser("far", "Female", 30, testLat+0.72, testLon)
+	createTestUsers(t, store, me, near, corner, far)
+
+	minLat, maxLat, minLon, maxLon := geo.BoundingBox(testLat, testLon, radiusKm)
+	if corner.Latitude < minLat || corner.Latitude > maxLat || corner.Longitude < minLon || corner.Longitude > maxLon {
+		t.Fatalf("corner user is outside the bounding box")
+	}
+	if distance := distanceKm(me, corner); distance <= radiusKm {
+		t.Fatalf("corner user is %.1fkm away, within the %.0fkm radius", distance, radiusKm)
+	}
+
+	tests := []struct {
+		name string
+		opts DiscoverOptions
+		want []string
+	}{
+		{"configured radius", DiscoverOptions{}, []string{"near"}},
+		{"max distance", DiscoverOptions{MaxDistanceKm: 5}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discoveredNames(t, store, me, tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("discovered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteDiscoverHidden(t *testing.T) {
+	store := newTestSQLite(t)
+	ctx := context.Background()
+
+	showMe := false
+	me := newTestUser("me", "Male", 30, testLat, testLon)
+	shown := newTestUser("shown", "Female", 30, testLat+0.01, testLon)
+	hidden := newTestUser("hidden", "Female", 30, testLat+0.02, testLon)
+	hidden.Preferences.ShowMe = &showMe
+	deactivated := newTestUser("deactivated", "Female", 30, testLat+0.03, testLon)
+	deactivated.Deactivated = true
+	createTestUsers(t, store, me, shown, hidden, deactivated)
+
+	if got, want := discoveredNames(t, store, me, DiscoverOptions{}), []string{"shown"}; !slices.Equal(got, want) {
+		t.Errorf("discovered %v, want %v", got, want)
+	}
+
+	// Reactivating brings the user back
+	if err := store.SetDeactivated(ctx, deactivated.ID, false); err != nil {
+		t.Fatalf("SetDeactivated: %v", err)
+	}
+	got, err := store.GetUserByID(ctx, deactivated.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if got.Deactivated {
+		t.Errorf("Deactivated = true after reactivating")
+	}
+	if got, want := discoveredNames(t, store, me, DiscoverOptions{}), []string{"shown", "deactivated"}; !slices.Equal(got, want) {
+		t.Errorf("discovered %v, want %v", got, want)
+	}
+}
+
+func TestSQLiteSuperLikeQuotas(t *testing.T) {
+	store := newTestSQLite(t)
+	ctx := context.Background()
+
+	me := newTestUser("me", "Male", 30, testLat, testLon)
+	first := newTestUser("first", "Female", 30, testLat, testLon)
+	second := newTestUser("second", "Female", 30, testLat, testLon)
+	third := newTestUser("third", "Female", 30, testLat, testLon)
+	createTestUsers(t, store, me, first, second, third)
+
+	now := time.Now().UTC()
+	swipe := func(swiped appModel.User, at time.Time) error {
+		_, _, err := store.RecordSwipe(ctx, appModel.Swipe{SwiperId: me.ID, SwipedId: swiped.ID, Preference: appModel.SwipeSuper, CreatedAt: at})
+		return err
+	}
+	if err := swipe(first, now.Add(-24*time.Hour)); err != nil {
+		t.Fatalf("super-like yesterday: %v", err)
+	}
+	if err := swipe(second, now); err != nil {
+		t.Fatalf("super-like today: %v", err)
+	}
+	if err := swipe(third, now); !errors.Is(err, ErrSuperLikeQuotaExceeded) {
+		t.Errorf("second super-like today = %v, want %v", err, ErrSuperLikeQuotaExceeded)
+	}
+
+	// Yesterday's count is dropped once today's is taken
+	var days []string
+	rows, err := store.db.Query(`SELECT day FROM super_like_quotas WHERE user_id = $1`, me.ID)
+	if err != nil {
+		t.Fatalf("list quotas: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			t.Fatal(err)
+		}
+		days = append(days, day)
+	}
+	if want := []string{superLikeDay(now)}; !slices.Equal(days, want) {
+		t.Errorf("quota days = %v, want %v", days, want)
+	}
+}
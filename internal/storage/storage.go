@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"context"
+	appConfig "dating-app-backend/internal/config"
+	appLogger "dating-app-backend/internal/logger"
+	"dating-app-backend/internal/model"
+	"dating-app-backend/internal/ranking"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	BackendDynamoDB = "dynamodb"
+	BackendMemory   = "memory"
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrMatchNotFound = errors.New("match not found")
+	// ErrUnmatched is a swipe between two users whose match has ended.
+	ErrUnmatched = errors.New("users have unmatched")
+	// ErrSuperLikeQuotaExceeded is a SUPER swipe by a user who has already
+	// sent their daily allowance.
+	ErrSuperLikeQuotaExceeded = errors.New("super-like quota exceeded")
+	// ErrSwipeConflict is a swipe that was not recorded because other swipes
+	// on the same user kept being written first. It is safe to retry.
+	ErrSwipeConflict = errors.New("too many concurrent swipes on the swiped user")
+	// ErrRankingExpired is a discovery page continuing a Window whose stored
+	// ranking is gone, usually because it is older than WindowRankingTTL.
+	ErrRankingExpired = errors.New("discovery ranking expired")
+)
+
+// UserRepository persists user profiles.
+type UserRepository interface {
+	CreateUser(ctx context.Context, user model.User) error
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetUserByID(ctx context.Context, userID string) (*model.User, error)
+	// UpdateUser replaces the stored user with user, swipe counters and
+	// rating included. To change one field of a user, use the writes below,
+	// which leave the rest as stored and so keep swipes counted meanwhile.
+	UpdateUser(ctx context.Context, user *model.User) error
+	// UpdatePreferences replaces userID's discovery preferences. It returns
+	// ErrUserNotFound if there is no such user.
+	UpdatePreferences(ctx context.Context, userID string, prefs model.DiscoveryPreferences) error
+	// SetDeactivated deactivates or reactivates userID's account. It returns
+	// ErrUserNotFound if there is no such user.
+	SetDeactivated(ctx context.Context, userID string, deactivated bool) error
+}
+
+// ScoreRepository is used to recompute attractiveness scores in bulk.
+type ScoreRepository interface {
+	// ScanUsers calls fn with every user, a batch at a time, in no
+	// particular order. It stops at the first error fn returns.
+	ScanUsers(ctx context.Context, fn func(users []model.User) error) error
+	// UpdateAttractivenessScore stores user.AttractivenessScore. It writes
+	// nothing and returns false if the stored swipe counters no longer match
+	// user's, because a swipe has rescored the user in the meantime.
+	UpdateAttractivenessScore(ctx context.Context, user model.User) (bool, error)
+}
+
+// RecommendationRepository stores the candidate lists built offline by
+// cmd/recommender from the swipe history.
+type RecommendationRepository interface {
+	// ScanSwipes calls fn with every swipe, a batch at a time, in no
+	// particular order. It stops at the first error fn returns.
+	ScanSwipes(ctx context.Context, fn func(swipes []model.Swipe) error) error
+	// PutRecommendations replaces userID's candidate list with
+	// recommendations, which maps candidate IDs to scores.
+	PutRecommendations(ctx context.Context, userID string, recommendations map[string]float64) error
+	// GetRecommendations returns userID's candidate list. It is empty, not an
+	// error, for users without one.
+	GetRecommendations(ctx context.Context, userID string) (map[string]float64, error)
+}
+
+// PicksRepository stores each user's daily picks. Only the latest day is
+// kept per user.
+type PicksRepository interface {
+	// GetPicks returns the picks stored for currentUser on day, in order, with
+	// the distance from currentUser filled in. Picks currentUser has swiped
+	// on since, or who have hidden themselves or deactivated their account,
+	// are left out. ok is false if no picks were stored for day.
+	GetPicks(ctx context.Context, currentUser model.User, day string) (picks []model.UserPublicData, ok bool, err error)
+	// PutPicks stores pickIDs as userID's picks for day. It does nothing if
+	// picks for day are already stored, so the first set written for a day
+	// is the one that sticks.
+	PutPicks(ctx context.Context, userID string, day string, pickIDs []string) error
+}
+
+// MatchRepository lists and ends users' matches.
+type MatchRepository interface {
+	// ListMatches returns userID's active matches, newest first.
+	ListMatches(ctx context.Context, userID string, opts ListMatchesOptions) (MatchPage, error)
+	// MarkMatchRead marks matchID read for userID. It returns
+	// ErrMatchNotFound unless userID is in the match.
+	MarkMatchRead(ctx context.Context, userID string, matchID string) error
+	// EndMatch ends matchID on behalf of userID, hiding it from both users.
+	// It returns ErrMatchNotFound unless userID is in the match and it is
+	// still active.
+	EndMatch(ctx context.Context, userID string, matchID string) error
+}
+
+type ListMatchesOptions struct {
+	// Limit is the page size. It must be positive.
+	Limit      int32
+	UnreadOnly bool
+	// Before continues a previous page with the matches older than this
+	// match ID.
+	Before string
+}
+
+// MatchPage is one page of a user's matches.
+type MatchPage struct {
+	Matches []model.UserMatch
+	// Next is the Before of the following page. It is set when more matches
+	// follow.
+	Next string
+}
+
+// matchPage cuts matches, newest first and fetched one past the limit, down
+// to a page.
+func matchPage(matches []model.UserMatch, limit int32) MatchPage {
+	page := MatchPage{Matches: matches}
+	if limit > 0 && len(matches) > int(limit) {
+		page.Matches = matches[:limit]
+		page.Next = page.Matches[limit-1].ID
+	}
+	return page
+}
+
+// DiscoverOptions narrows down and orders discovery results.
+type DiscoverOptions struct {
+	Limit  int32
+	MinAge int
+	MaxAge int
+	// Genders keeps candidates of any of these genders. Empty keeps all.
+	Genders []string
+	// Ranker orders the results. Nil means ranking.Combined.
+	Ranker ranking.Ranker
+	// Recommendations are the current user's recommended candidates and
+	// their scores, for rankers that use them.
+	Recommendations map[string]float64
+	// SuperLikedBy holds the IDs of candidates who have super-liked the
+	// current user. They are ranked ahead of everyone else.
+	SuperLikedBy map[string]bool
+	// MaxDistanceKm limits results to this distance from the current user.
+	// Zero means the configured discovery radius, which is also the upper
+	// bound.
+	MaxDistanceKm float64
+	// Diversity is the weight of diversity re-ranking, between 0 and 1. Zero
+	// returns results in plain ranking order.
+	Diversity float64
+	// After continues a previous page from this position in the ranking.
+	After *Position
+}
+
+// Position identifies a result in the discovery ranking, so that the next
+// page can start right after it.
+type Position struct {
+	// ID is empty at the start of Window.
+	ID string `json:"id"`
+	// Shown lists results past this position that diversity re-ranking has
+	// already returned.
+	Shown []string `json:"shown,omitempty"`
+	// Window holds the candidates the position is in the ranking of.
+	Window Window `json:"window"`
+}
+
+// Window is a stretch of candidates in DistanceKey order that are ranked
+// together. Discovery ranks at most maxDiscoveryCandidates at once, so
+// candidates further away are ranked in later windows, after everyone in
+// the nearer ones has been returned.
+type Window struct {
+	// After is the key the window starts after. Nil starts at the current
+	// user.
+	After *DistanceKey `json:"after,omitempty"`
+	// Last is the key of the window's furthest candidate, fixed when the
+	// window is first ranked so that users arriving or leaving cannot move
+	// its edge between pages. Nil means it reaches the search radius.
+	Last *DistanceKey `json:"last,omitempty"`
+	// Ranking is the ID of the window's ranking, stored when a page first
+	// ends inside the window. Later pages follow it rather than ranking
+	// again, since candidates' scores change as they are swiped on.
+	Ranking string `json:"ranking,omitempty"`
+}
+
+// WindowRankingTTL is how long the ranking of a Window is kept, and so how
+// long a discovery cursor can be used.
+const WindowRankingTTL = 24 * time.Hour
+
+// windowRankings stores the rankings of discovery windows.
+type windowRankings interface {
+	// putWindowRanking stores ids, the ranked candidate IDs of a window,
+	// as userID's ranking rankingID.
+	putWindowRanking(ctx context.Context, userID, rankingID string, ids []string) error
+	// getWindowRanking returns userID's ranking rankingID, or
+	// ErrRankingExpired if there is none younger than WindowRankingTTL.
+	getWindowRanking(ctx context.Context, userID, rankingID string) ([]string, error)
+}
+
+// DistanceKey orders candidates by their distance from the current user,
+// breaking ties on ID.
+type DistanceKey struct {
+	Km float64 `json:"km"`
+	ID string  `json:"id"`
+}
+
+// Before reports whether k comes before other.
+func (k DistanceKey) Before(other DistanceKey) bool {
+	if k.Km != other.Km {
+		return k.Km < other.Km
+	}
+	return k.ID < other.ID
+}
+
+// DiscoverPage is one page of ranked discovery results.
+type DiscoverPage struct {
+	Results []model.UserPublicData
+	// Next is set when more results follow this page.
+	Next *Position
+}
+
+// DiscoveryRepository finds candidate profiles for a user.
+type DiscoveryRepository interface {
+	DiscoverUsers(ctx context.Context, currentUser model.User, opts DiscoverOptions) (DiscoverPage, error)
+}
+
+// SwipeRepository records swipes and reports matches.
+type SwipeRepository interface {
+	// RecordSwipe stores swipe and reports whether it completed a match. A
+	// match is stored in the same write as the swipe that completes it, and
+	// its ID is returned. It returns ErrUserNotFound if either user does not
+	// exist, and ErrUnmatched if the pair's match has been ended.
+	//
+	// A SUPER swipe uses up one of the swiper's super-likes for the UTC day
+	// of swipe.CreatedAt, in the same write, and fails with
+	// ErrSuperLikeQuotaExceeded if none are left. Repeat swipes do not.
+	RecordSwipe(ctx context.Context, swipe model.Swipe) (bool, string, error)
+}
+
+// MaxSuperLikes caps how many super-likes ListSuperLikes returns.
+const MaxSuperLikes = 100
+
+// SuperLikeTTL is how long a received super-like is listed. Backends that
+// store super-likes apart from the swipe delete them after this.
+const SuperLikeTTL = 30 * 24 * time.Hour
+
+// SuperLikeRepository lists the super-likes users have received.
+type SuperLikeRepository interface {
+	// ListSuperLikes returns the super-likes userID has received in the
+	// last SuperLikeTTL, newest first and at most MaxSuperLikes.
+	ListSuperLikes(ctx context.Context, userID string, opts ListSuperLikesOptions) ([]model.SuperLike, error)
+	// MarkSuperLikesRead marks every super-like userID has received read.
+	MarkSuperLikesRead(ctx context.Context, userID string) error
+}
+
+type ListSuperLikesOptions struct {
+	UnreadOnly bool
+}
+
+// superLikeDay is the UTC day a super-like sent at t counts against.
+func superLikeDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// superLikeDayEnd is when the UTC day a super-like sent at t counts against
+// ends, and its count is no longer needed.
+func superLikeDayEnd(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// IdempotencyKeyTTL is how long the result of a swipe sent with an
+// Idempotency-Key is kept.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyRepository keeps the results of swipes sent with an
+// Idempotency-Key, so a retried request can be answered like the original.
+type IdempotencyRepository interface {
+	// GetSwipeResult returns the result stored under userID and key, and
+	// false if there is none or it is older than IdempotencyKeyTTL.
+	GetSwipeResult(ctx context.Context, userID, key string) (SwipeResult, bool, error)
+	// PutSwipeResult stores result under userID and key, unless a result
+	// that has not expired is already stored there.
+	PutSwipeResult(ctx context.Context, userID, key string, result SwipeResult) error
+}
+
+// SwipeResult is a swipe request and the response it got.
+type SwipeResult struct {
+	SwipedId   string
+	Preference model.SwipePreference
+	Matched    bool
+	MatchId    string
+	CreatedAt  time.Time
+}
+
+func (r SwipeResult) expired() bool {
+	return time.Since(r.CreatedAt) > IdempotencyKeyTTL
+}
+
+// Storage is the full set of operations a backend has to provide.
+type Storage interface {
+	UserRepository
+	DiscoveryRepository
+	SwipeRepository
+	SuperLikeRepository
+	IdempotencyRepository
+	ScoreRepository
+	RecommendationRepository
+	PicksRepository
+	MatchRepository
+}
+
+var (
+	_ Storage = (*DynamoDB)(nil)
+	_ Storage = (*Memory)(nil)
+	_ Storage = (*Postgres)(nil)
+	_ Storage = (*SQLite)(nil)
+)
+
+// New returns the backend selected by cfg.StorageBackend.
+func New(cfg *appConfig.Config, logger *appLogger.Logger) (Storage, error) {
+	switch cfg.StorageBackend {
+	case BackendDynamoDB, "":
+		return NewDynamoDB(cfg, logger)
+	case BackendMemory:
+		return NewMemory(cfg, logger), nil
+	case BackendPostgres:
+		return NewPostgres(cfg, logger)
+	case BackendSQLite:
+		return NewSQLite(cfg, logger)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
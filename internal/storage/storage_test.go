@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	appConfig "dating-app-backend/internal/config"
+	appLogger "dating-app-backend/internal/logger"
+	appModel "dating-app-backend/internal/model"
+	"dating-app-backend/internal/ranking"
+)
+
+// London is where the discovery tests place the current user.
+const testLat, testLon = 51.5074, -0.1278
+
+// testConfig is the configuration the storage tests run with.
+func testConfig() *appConfig.Config {
+	return &appConfig.Config{DiscoveryRadiusKm: 50, SuperLikesPerDay: 1}
+}
+
+// testLogger discards everything, keeping test output readable.
+func testLogger() *appLogger.Logger {
+	return &appLogger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// newTestUser returns a user called name at lat, lon, with no discovery
+// preferences of their own.
+func newTestUser(name, gender string, age int, lat, lon float64) appModel.User {
+	user := appModel.GenerateRandomUser()
+	user.Email = name + "@example.com"
+	user.Name = name
+	user.Gender = gender
+	user.Age = age
+	user.Latitude = lat
+	user.Longitude = lon
+	return user
+}
+
+// createTestUsers stores users, failing the test on the first error.
+func createTestUsers(t *testing.T, users UserRepository, toCreate ...appModel.User) {
+	t.Helper()
+	for _, user := range toCreate {
+		if err := users.CreateUser(context.Background(), user); err != nil {
+			t.Fatalf("CreateUser(%s): %v", user.Name, err)
+		}
+	}
+}
+
+// discoveredNames returns the names of the users discovery returns for
+// currentUser, nearest first.
+func discoveredNames(t *testing.T, discovery DiscoveryRepository, currentUser appModel.User, opts DiscoverOptions) []string {
+	t.Helper()
+	opts.Ranker = ranking.Distance{}
+	page, err := discovery.DiscoverUsers(context.Background(), currentUser, opts)
+	if err != nil {
+		t.Fatalf("DiscoverUsers: %v", err)
+	}
+	names := make([]string, len(page.Results))
+	for i, result := range page.Results {
+		names[i] = result.Name
+	}
+	return names
+}
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	appModel "dating-app-backend/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	superLikesTableName      = "SuperLikesTable"
+	superLikeQuotasTableName = "SuperLikeQuotasTable"
+)
+
+// superLikeItem is a super-like stored under the super-liked user. Its
+// SuperLikeId is a ULID, so a user's super-likes sort by time. DynamoDB
+// deletes it some time after ExpiresAt, a Unix time in seconds.
+type superLikeItem struct {
+	UserId      string    `dynamodbav:"UserId"`
+	SuperLikeId string    `dynamodbav:"SuperLikeId"`
+	SwiperId    string    `dynamodbav:"SwiperId"`
+	CreatedAt   time.Time `dynamodbav:"CreatedAt"`
+	Unread      bool      `dynamodbav:"Unread"`
+	ExpiresAt   int64     `dynamodbav:"ExpiresAt"`
+}
+
+func (db *DynamoDB) createSuperLikesTable() error {
+	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("UserId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("SuperLikeId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("UserId"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("SuperLikeId"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		TableName:   aws.String(superLikesTableName),
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var resourceInUseErr *types.ResourceInUseException
+		if errors.As(err, &resourceInUseErr) {
+			db.logger.Warn("SuperLikes table already exists")
+			return nil
+		}
+		db.logger.Error("Failed to create SuperLikes table", "error", err)
+		return err
+	}
+
+	if err := db.enableTimeToLive(superLikesTableName); err != nil {
+		db.logger.Error("Failed to enable time to live on SuperLikes table", "error", err)
+		return err
+	}
+
+	db.logger.Info("Successfully created SuperLikes table")
+	return nil
+}
+
+// createSuperLikeQuotasTable creates the table counting each user's
+// super-likes per day, keyed by UserId and Day. DynamoDB deletes a day's
+// count some time after its ExpiresAt, the end of the day.
+func (db *DynamoDB) createSuperLikeQuotasTable() error {
+	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("UserId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("Day"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("UserId"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("Day"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		TableName:   aws.String(superLikeQuotasTableName),
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var resourceInUseErr *types.ResourceInUseException
+		if errors.As(err, &resourceInUseErr) {
+			db.logger.Warn("SuperLikeQuotas table already exists")
+			return nil
+		}
+		db.logger.Error("Failed to create SuperLikeQuotas table", "error", err)
+		return err
+	}
+
+	if err := db.enableTimeToLive(superLikeQuotasTableName); err != nil {
+		db.logger.Error("Failed to enable time to live on SuperLikeQuotas table", "error", err)
+		return err
+	}
+
+	db.logger.Info("Successfully created SuperLikeQuotas table")
+	return nil
+}
+
+// superLikeWrites returns the transaction items that store swipe, a SUPER
+// swipe: the use of one of the swiper's super-likes for the day, first, which
+// fails its condition if none are left, and the super-like itself.
+func (db *DynamoDB) superLikeWrites(swipe appModel.Swipe) ([]types.TransactWriteItem, error) {
+	if db.superLikesPerDay <= 0 {
+		return nil, ErrSuperLikeQuotaExceeded
+	}
+
+	item, err := attributevalue.MarshalMap(superLikeItem{
+		UserId:      swipe.SwipedId,
+		SuperLikeId: ulid.MustNew(ulid.Timestamp(swipe.CreatedAt), ulid.DefaultEntropy()).String(),
+		SwiperId:    swipe.SwiperId,
+		CreatedAt:   swipe.CreatedAt,
+		Unread:      true,
+		ExpiresAt:   swipe.CreatedAt.Add(SuperLikeTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []types.TransactWriteItem{
+		{Update: &types.Update{
+			TableName: aws.String(superLikeQuotasTableName),
+			Key: map[string]types.AttributeValue{
+				"UserId": &types.AttributeValueMemberS{Value: swipe.SwiperId},
+				"Day":    &types.AttributeValueMemberS{Value: superLikeDay(swipe.CreatedAt)},
+			},
+			UpdateExpression:    aws.String("ADD Used :one SET ExpiresAt = :expiresAt"),
+			ConditionExpression: aws.String("attribute_not_exists(Used) OR Used < :limit"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":one":       &types.AttributeValueMemberN{Value: "1"},
+				":limit":     &types.AttributeValueMemberN{Value: strconv.Itoa(db.superLikesPerDay)},
+				":expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(superLikeDayEnd(swipe.CreatedAt).Unix(), 10)},
+			},
+		}},
+		{Put: &types.Put{
+			TableName: aws.String(superLikesTableName),
+			Item:      item,
+		}},
+	}, nil
+}
+
+func (db *DynamoDB) ListSuperLikes(ctx context.Context, userID string, opts ListSuperLikesOptions) ([]appModel.SuperLike, error) {
+	// Expired items linger until DynamoDB gets round to deleting them, so
+	// only ask for the ones created since
+	var since ulid.ULID
+	if err := since.SetTime(ulid.Timestamp(time.Now().Add(-SuperLikeTTL))); err != nil {
+		return nil, err
+	}
+	values := map[string]types.AttributeValue{
+		":userId": &types.AttributeValueMemberS{Value: userID},
+		":since":  &types.AttributeValueMemberS{Value: since.String()},
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(superLikesTableName),
+		KeyConditionExpression:    aws.String("UserId = :userId AND SuperLikeId > :since"),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(MaxSuperLikes),
+	}
+	if opts.UnreadOnly {
+		input.FilterExpression = aws.String("Unread = :unread")
+		values[":unread"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+
+	// The filter applies after Limit, so keep paging until there are enough
+	var superLikes []appModel.SuperLike
+	paginator := dynamodb.NewQueryPaginator(db.client, input)
+	for paginator.HasMorePages() && len(superLikes) < MaxSuperLikes {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			db.logger.Error("Failed to query super-likes", "error", err, "userId", userID)
+			return nil, err
+		}
+
+		var items []superLikeItem
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			db.logger.Error("Failed to unmarshal super-likes", "error", err, "userId", userID)
+			return nil, err
+		}
+		for _, item := range items {
+			superLikes = append(superLikes, appModel.SuperLike{SwiperId: item.SwiperId, SwipedId: item.UserId, CreatedAt: item.CreatedAt, Unread: item.Unread})
+		}
+	}
+
+	if len(superLikes) > MaxSuperLikes {
+		superLikes = superLikes[:MaxSuperLikes]
+	}
+	return superLikes, nil
+}
+
+func (db *DynamoDB) MarkSuperLikesRead(ctx context.Context, userID string) error {
+	paginator := dynamodb.NewQueryPaginator(db.client, &dynamodb.QueryInput{
+		TableName:              aws.String(superLikesTableName),
+		KeyConditionExpression: aws.String("UserId = :userId"),
+		FilterExpression:       aws.String("Unread = :unread"),
+		ProjectionExpression:   aws.String("SuperLikeId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":userId": &types.AttributeValueMemberS{Value: userID},
+			":unread": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			db.logger.Error("Failed to query unread super-likes", "error", err, "userId", userID)
+			return err
+		}
+
+		for _, item := range page.Items {
+			// The condition keeps an item deleted in the meantime from
+			// being written back
+			_, err := db.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(superLikesTableName),
+				Key: map[string]types.AttributeValue{
+					"UserId":      &types.AttributeValueMemberS{Value: userID},
+					"SuperLikeId": item["SuperLikeId"],
+				},
+				UpdateExpression:    aws.String("SET Unread = :unread"),
+				ConditionExpression: aws.String("attribute_exists(UserId)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":unread": &types.AttributeValueMemberBOOL{Value: false},
+				},
+			})
+			var conditionFailed *types.ConditionalCheckFailedException
+			if err != nil && !errors.As(err, &conditionFailed) {
+				db.logger.Error("Failed to mark super-like read", "error", err, "userId", userID)
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	appModel "dating-app-backend/internal/model"
+)
+
+// TestSuperLikes checks that received super-likes are listed newest first
+// until they expire, and stay unread until marked read.
+func TestSuperLikes(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+			ctx := context.Background()
+
+			me := newTestUser("me", "Male", 30, testLat, testLon)
+			expired := newTestUser("expired", "Female", 30, testLat, testLon)
+			older := newTestUser("older", "Female", 30, testLat, testLon)
+			newer := newTestUser("newer", "Female", 30, testLat, testLon)
+			createTestUsers(t, store, me, expired, older, newer)
+
+			now := time.Now().UTC()
+			for _, swipe := range []appModel.Swipe{
+				{SwiperId: expired.ID, SwipedId: me.ID, Preference: appModel.SwipeSuper, CreatedAt: now.Add(-SuperLikeTTL - time.Hour)},
+				{SwiperId: older.ID, SwipedId: me.ID, Preference: appModel.SwipeSuper, CreatedAt: now.Add(-time.Hour)},
+				{SwiperId: newer.ID, SwipedId: me.ID, Preference: appModel.SwipeSuper, CreatedAt: now},
+			} {
+				if _, _, err := store.RecordSwipe(ctx, swipe); err != nil {
+					t.Fatalf("RecordSwipe: %v", err)
+				}
+			}
+
+			list := func(opts ListSuperLikesOptions) (swipers []string, unread []bool) {
+				t.Helper()
+				superLikes, err := store.ListSuperLikes(ctx, me.ID, opts)
+				if err != nil {
+					t.Fatalf("ListSuperLikes: %v", err)
+				}
+				for _, superLike := range superLikes {
+					swipers = append(swipers, superLike.SwiperId)
+					unread = append(unread, superLike.Unread)
+				}
+				return swipers, unread
+			}
+
+			swipers, unread := list(ListSuperLikesOptions{UnreadOnly: true})
+			if want := []string{newer.ID, older.ID}; !slices.Equal(swipers, want) || !slices.Equal(unread, []bool{true, true}) {
+				t.Errorf("unread super-likes = %v, %v, want %v, all unread", swipers, unread, want)
+			}
+
+			if err := store.MarkSuperLikesRead(ctx, me.ID); err != nil {
+				t.Fatalf("MarkSuperLikesRead: %v", err)
+			}
+			if swipers, _ := list(ListSuperLikesOptions{UnreadOnly: true}); len(swipers) != 0 {
+				t.Errorf("unread super-likes after marking them read = %v, want none", swipers)
+			}
+			swipers, unread = list(ListSuperLikesOptions{})
+			if want := []string{newer.ID, older.ID}; !slices.Equal(swipers, want) || !slices.Equal(unread, []bool{false, false}) {
+				t.Errorf("super-likes = %v, %v, want %v, all read", swipers, unread, want)
+			}
+		})
+	}
+}
@@ -3,6 +3,10 @@ package storage
 import (
 	"context"
 	"dating-app-backend/internal/model"
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -12,76 +16,300 @@ import (
 
 const swipesTableName = "SwipesTable"
 
+var (
+	// errRepeatSwipe is writeSwipe failing because another swipe by the
+	// swiper on the same user was written since the previous one was read.
+	errRepeatSwipe = errors.New("repeat swipe")
+	// errPairMatched is writeSwipe failing because the pair already has a
+	// match.
+	errPairMatched = errors.New("pair already matched")
+	// errSwipedUserChanged is writeSwipe failing because the swiped user's
+	// counters or rating were written since they were read.
+	errSwipedUserChanged = errors.New("swiped user changed")
+)
+
+const (
+	// maxSwipeAttempts caps how many times RecordSwipe rereads a swiped user
+	// whose rating concurrent swipes keep changing.
+	maxSwipeAttempts = 5
+	// swipeRetryBackoff bounds the wait before RecordSwipe's second attempt.
+	// The bound doubles with each attempt after that.
+	swipeRetryBackoff = 10 * time.Millisecond
+)
+
 func (db *DynamoDB) RecordSwipe(ctx context.Context, swipe model.Swipe) (bool, string, error) {
 	db.logger.Info("Recording swipe", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "preference", swipe.Preference)
 
-	// Update swipe statistics for the swiped user
-	swipedUser, err := db.GetUserByID(ctx, swipe.SwipedId)
-	if err != nil {
-		db.logger.Error("Failed to get swiped user", "error", err, "swipedId", swipe.SwipedId)
-		return false, "", err
-	}
+	for attempt := 1; ; attempt++ {
+		matched, matchID, err := db.recordSwipe(ctx, swipe)
+		if !errors.Is(err, errSwipedUserChanged) {
+			return matched, matchID, err
+		}
+		if attempt == maxSwipeAttempts {
+			db.logger.Warn("Swiped user kept changing, giving up", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
+			return false, "", ErrSwipeConflict
+		}
+		db.logger.Info("Swiped user changed concurrently, retrying", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "attempt", attempt)
 
-	swipedUser.TotalSwipes++
-	if swipe.Preference == model.SwipeYes {
-		swipedUser.YesSwipes++
+		// A random wait keeps the swipes that collided from colliding again
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(swipeRetryBackoff << (attempt - 1))))):
+		case <-ctx.Done():
+			return false, "", ctx.Err()
+		}
 	}
-	swipedUser.UpdateAttractivenessScore()
+}
 
-	// TODO: maybe do this using the listener on the DynamoDB stream
-	// Update the swiped user in the database
-	err = db.UpdateUser(ctx, swipedUser)
+// recordSwipe makes one attempt at RecordSwipe. It fails with
+// errSwipedUserChanged if another swipe on the same user is written first.
+func (db *DynamoDB) recordSwipe(ctx context.Context, swipe model.Swipe) (bool, string, error) {
+	// The write is conditional on the counters read here, so they must be
+	// the latest
+	swipedUser, err := db.getUser(ctx, swipe.SwipedId, true)
 	if err != nil {
-		db.logger.Error("Failed to update swiped user", "error", err, "swipedId", swipe.SwipedId)
+		db.logger.Error("Failed to get swiped user", "error", err, "swipedId", swipe.SwipedId)
 		return false, "", err
 	}
 
-	item, err := attributevalue.MarshalMap(swipe)
+	swiper, err := db.GetUserByID(ctx, swipe.SwiperId)
 	if err != nil {
-		db.logger.Error("Failed to marshal swipe", "error", err)
+		db.logger.Error("Failed to get swiper", "error", err, "swiperId", swipe.SwiperId)
 		return false, "", err
 	}
 
-	_, err = db.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(swipesTableName),
-		Item:      item,
-	})
+	previous, err := db.getSwipe(ctx, swipe.SwiperId, swipe.SwipedId)
 	if err != nil {
-		db.logger.Error("Failed to put swipe in DynamoDB", "error", err)
+		db.logger.Error("Failed to check for earlier swipe", "error", err)
 		return false, "", err
 	}
+	if previous != nil && !model.CanReviseSwipe(previous.Preference, swipe.Preference) {
+		return db.repeatSwipe(ctx, *previous)
+	}
+
+	// The counters, rating and score are written together with the swipe.
+	// The counters are added to and the rating is only written if it is
+	// still the one read above, so concurrent swipes on the same user cannot
+	// lose updates. A user stored before
+	// ratings existed has no rating yet and is given one from the initial
+	// rating here.
+	previousCounters := *swipedUser
+	if previous == nil {
+		swipedUser.TotalSwipes++
+		if swipe.Preference.Likes() {
+			swipedUser.YesSwipes++
+		}
+		swipedUser.UpdateAttractivenessScore()
+		swipedUser.UpdateRating(swiper.CurrentRating(), swipe.Preference)
+	} else {
+		db.logger.Info("Revising swipe", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "from", previous.Preference)
+		swipedUser.ReviseSwipe()
+	}
+	counters := countersUpdate(previousCounters, *swipedUser)
 
 	// TODO: A lambda handler on the DynamoDB stream could be used to check for matches
 
-	// Check for a match
-	if swipe.Preference == model.SwipeYes {
-		matchResult, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
-			TableName: aws.String(swipesTableName),
-			Key: map[string]types.AttributeValue{
-				"SwiperId": &types.AttributeValueMemberS{Value: swipe.SwipedId},
-				"SwipedId": &types.AttributeValueMemberS{Value: swipe.SwiperId},
-			},
-		})
+	// Check for a match before writing, so the swipe and the match it
+	// completes can be stored together
+	matched := false
+	if swipe.Preference.Likes() {
+		matchSwipe, err := db.getSwipe(ctx, swipe.SwipedId, swipe.SwiperId)
 		if err != nil {
 			db.logger.Error("Failed to check for match", "error", err)
 			return false, "", err
 		}
+		matched = matchSwipe != nil && matchSwipe.Preference.Likes()
+	}
+
+	var match *model.Match
+	if matched {
+		newMatch := model.NewMatch(swipe.SwiperId, swipe.SwipedId, swipe.CreatedAt)
+		match = &newMatch
+	}
 
-		if matchResult.Item != nil {
-			var matchSwipe model.Swipe
-			err = attributevalue.UnmarshalMap(matchResult.Item, &matchSwipe)
-			if err != nil {
-				db.logger.Error("Failed to unmarshal match swipe", "error", err)
-				return false, "", err
-			}
-
-			if matchSwipe.Preference == model.SwipeYes {
-				db.logger.Info("Match found", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
-				return true, swipe.SwipedId, nil
-			}
+	// A pair that already has a match keeps it
+	err = db.writeSwipe(ctx, swipe, previous, counters, match)
+	pairMatched := errors.Is(err, errPairMatched)
+	if pairMatched {
+		match = nil
+		err = db.writeSwipe(ctx, swipe, previous, counters, nil)
+	}
+	if errors.Is(err, errSwipedUserChanged) {
+		return false, "", err
+	}
+	if errors.Is(err, errRepeatSwipe) {
+		// The same swipe, sent concurrently, was written first
+		previous, err = db.getSwipe(ctx, swipe.SwiperId, swipe.SwipedId)
+		if err != nil {
+			db.logger.Error("Failed to get earlier swipe", "error", err)
+			return false, "", err
 		}
+		return db.repeatSwipe(ctx, *previous)
+	}
+	if errors.Is(err, ErrSuperLikeQuotaExceeded) {
+		db.logger.Warn("Super-like quota exceeded", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
+		return false, "", err
+	}
+	if err != nil {
+		db.logger.Error("Failed to write swipe to DynamoDB", "error", err)
+		return false, "", err
+	}
+	db.seen.add(swipe.SwiperId, swipe.SwipedId)
+
+	var matchID string
+	var status model.MatchStatus
+	switch {
+	case match != nil:
+		matchID, status = match.ID, match.Status
+	case pairMatched:
+		userAId, userBId := model.MatchPair(swipe.SwiperId, swipe.SwipedId)
+		if matchID, status, err = db.getPairMatch(ctx, userAId, userBId); err != nil {
+			db.logger.Error("Failed to get existing match", "error", err)
+			return false, "", err
+		}
+	}
+
+	// A pair whose match was ended cannot match again
+	if status == model.MatchActive {
+		db.logger.Info("Match found", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId, "matchId", matchID)
+		return true, matchID, nil
 	}
 
 	db.logger.Info("Swipe recorded successfully", "swiperId", swipe.SwiperId, "swipedId", swipe.SwipedId)
 	return false, "", nil
 }
+
+// countersUpdate adds the swipe counted in updated to the stored swipe
+// counters, and writes updated's rating and attractiveness score. The rating
+// is worked out from the one it replaces, so it is written on condition that
+// the stored one is still previous's.
+func countersUpdate(previous, updated model.User) *types.Update {
+	// A rating that has never been written is missing rather than zero
+	condition := "attribute_exists(ID) AND Rating = :previousRating"
+	if previous.Rating == 0 {
+		condition = "attribute_exists(ID) AND (attribute_not_exists(Rating) OR Rating = :previousRating)"
+	}
+
+	return &types.Update{
+		TableName: aws.String(usersTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: updated.ID},
+		},
+		UpdateExpression:    aws.String("ADD TotalSwipes :totalSwipes, YesSwipes :yesSwipes SET Rating = :rating, AttractivenessScore = :score"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":totalSwipes":    &types.AttributeValueMemberN{Value: strconv.Itoa(updated.TotalSwipes - previous.TotalSwipes)},
+			":yesSwipes":      &types.AttributeValueMemberN{Value: strconv.Itoa(updated.YesSwipes - previous.YesSwipes)},
+			":rating":         &types.AttributeValueMemberN{Value: strconv.FormatFloat(updated.Rating, 'f', -1, 64)},
+			":score":          &types.AttributeValueMemberN{Value: strconv.FormatFloat(updated.AttractivenessScore, 'f', -1, 64)},
+			":previousRating": &types.AttributeValueMemberN{Value: strconv.FormatFloat(previous.Rating, 'f', -1, 64)},
+		},
+	}
+}
+
+// writeSwipe stores swipe in one transaction with counters, the update of the
+// swiped user's counters, and match, the match the swipe completes, which may
+// be nil. The swipe replaces previous, the swiper's earlier swipe on the
+// user, and fails with errRepeatSwipe if that has changed since it was read,
+// or with errSwipedUserChanged if the swiped user has.
+// A SUPER swipe also uses up one of the swiper's super-likes for the day, and
+// fails with ErrSuperLikeQuotaExceeded if none are left.
+func (db *DynamoDB) writeSwipe(ctx context.Context, swipe model.Swipe, previous *model.Swipe, counters *types.Update, match *model.Match) error {
+	item, err := attributevalue.MarshalMap(swipe)
+	if err != nil {
+		return err
+	}
+
+	put := &types.Put{
+		TableName:           aws.String(swipesTableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(SwiperId)"),
+	}
+	if previous != nil {
+		put.ConditionExpression = aws.String("#preference = :previous")
+		put.ExpressionAttributeNames = map[string]string{"#preference": "Preference"}
+		put.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":previous": &types.AttributeValueMemberS{Value: string(previous.Preference)},
+		}
+	}
+	items := []types.TransactWriteItem{{Put: put}, {Update: counters}}
+	quota := -1
+	if swipe.Preference == model.SwipeSuper {
+		writes, err := db.superLikeWrites(swipe)
+		if err != nil {
+			return err
+		}
+		quota = len(items)
+		items = append(items, writes...)
+	}
+	pairGuard := -1
+	if match != nil {
+		writes, err := matchWrites(*match, swipe)
+		if err != nil {
+			return err
+		}
+		pairGuard = len(items)
+		items = append(items, writes...)
+	}
+
+	_, err = db.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	switch {
+	case transactionConditionFailed(err, 0):
+		return errRepeatSwipe
+	case transactionConditionFailed(err, 1):
+		return errSwipedUserChanged
+	case quota >= 0 && transactionConditionFailed(err, quota):
+		return ErrSuperLikeQuotaExceeded
+	case pairGuard >= 0 && transactionConditionFailed(err, pairGuard):
+		return errPairMatched
+	}
+	return err
+}
+
+// getSwipe returns swiperID's swipe on swipedID, or nil if there is none.
+func (db *DynamoDB) getSwipe(ctx context.Context, swiperID, swipedID string) (*model.Swipe, error) {
+	result, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(swipesTableName),
+		Key: map[string]types.AttributeValue{
+			"SwiperId": &types.AttributeValueMemberS{Value: swiperID},
+			"SwipedId": &types.AttributeValueMemberS{Value: swipedID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var swipe model.Swipe
+	if err := attributevalue.UnmarshalMap(result.Item, &swipe); err != nil {
+		return nil, err
+	}
+	return &swipe, nil
+}
+
+// repeatSwipe returns the result of previous, a swipe that is being
+// repeated: the pair's match, if it led to one. It fails with ErrUnmatched
+// if that match has been ended.
+func (db *DynamoDB) repeatSwipe(ctx context.Context, previous model.Swipe) (bool, string, error) {
+	matched, matchID := false, ""
+	if previous.Preference.Likes() {
+		userAId, userBId := model.MatchPair(previous.SwiperId, previous.SwipedId)
+		id, status, err := db.getPairMatch(ctx, userAId, userBId)
+		if err != nil {
+			db.logger.Error("Failed to get existing match", "error", err)
+			return false, "", err
+		}
+		switch status {
+		case model.MatchActive:
+			matched, matchID = true, id
+		case model.MatchEnded:
+			db.logger.Warn("Swipe between unmatched users", "swiperId", previous.SwiperId, "swipedId", previous.SwipedId)
+			return false, "", ErrUnmatched
+		}
+	}
+
+	db.logger.Info("Repeat swipe, returning the original result", "swiperId", previous.SwiperId, "swipedId", previous.SwipedId, "matched", matched)
+	return matched, matchID, nil
+}
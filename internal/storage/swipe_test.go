@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appModel "dating-app-backend/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestCountersUpdate(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, updated appModel.User
+		wantTotal         string
+		wantYes           string
+		wantCondition     string
+	}{
+		{
+			name:          "first swipe, a YES",
+			previous:      appModel.User{ID: "u"},
+			updated:       appModel.User{ID: "u", TotalSwipes: 1, YesSwipes: 1, Rating: 1516},
+			wantTotal:     "1",
+			wantYes:       "1",
+			wantCondition: "attribute_exists(ID) AND (attribute_not_exists(Rating) OR Rating = :previousRating)",
+		},
+		{
+			name:          "a NO",
+			previous:      appModel.User{ID: "u", TotalSwipes: 4, YesSwipes: 2, Rating: 1510},
+			updated:       appModel.User{ID: "u", TotalSwipes: 5, YesSwipes: 2, Rating: 1495},
+			wantTotal:     "1",
+			wantYes:       "0",
+			wantCondition: "attribute_exists(ID) AND Rating = :previousRating",
+		},
+		{
+			name:          "NO revised to YES",
+			previous:      appModel.User{ID: "u", TotalSwipes: 5, YesSwipes: 2, Rating: 1495},
+			updated:       appModel.User{ID: "u", TotalSwipes: 5, YesSwipes: 3, Rating: 1527},
+			wantTotal:     "0",
+			wantYes:       "1",
+			wantCondition: "attribute_exists(ID) AND Rating = :previousRating",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := countersUpdate(tt.previous, tt.updated)
+			if got, want := aws.ToString(update.UpdateExpression), "ADD TotalSwipes :totalSwipes, YesSwipes :yesSwipes SET Rating = :rating, AttractivenessScore = :score"; got != want {
+				t.Errorf("UpdateExpression = %q, want %q", got, want)
+			}
+			if got := aws.ToString(update.ConditionExpression); got != tt.wantCondition {
+				t.Errorf("ConditionExpression = %q, want %q", got, tt.wantCondition)
+			}
+			number := func(name string) string {
+				return update.ExpressionAttributeValues[name].(*types.AttributeValueMemberN).Value
+			}
+			if got := number(":totalSwipes"); got != tt.wantTotal {
+				t.Errorf("TotalSwipes added = %s, want %s", got, tt.wantTotal)
+			}
+			if got := number(":yesSwipes"); got != tt.wantYes {
+				t.Errorf("YesSwipes added = %s, want %s", got, tt.wantYes)
+			}
+		})
+	}
+}
+
+// TestRecordSwipeRepeat checks that a repeat swipe gets the result of the
+// original and leaves the swiped user as it was, unless it revises a NO to
+// a YES or SUPER, which counts as a like from then on.
+func TestRecordSwipeRepeat(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	// Between two users on the initial rating, a like gains half of ratingK
+	// and a NO loses as much
+	const liked, disliked = appModel.InitialRating + 16, appModel.InitialRating - 16
+	tests := []struct {
+		name       string
+		swipes     []appModel.SwipePreference
+		wantYes    int
+		wantRating float64
+	}{
+		{"NO then NO", []appModel.SwipePreference{appModel.SwipeNo, appModel.SwipeNo}, 0, disliked},
+		{"YES then YES", []appModel.SwipePreference{appModel.SwipeYes, appModel.SwipeYes}, 1, liked},
+		{"YES then NO", []appModel.SwipePreference{appModel.SwipeYes, appModel.SwipeNo}, 1, liked},
+		{"SUPER then YES", []appModel.SwipePreference{appModel.SwipeSuper, appModel.SwipeYes}, 1, liked},
+		{"NO revised to YES", []appModel.SwipePreference{appModel.SwipeNo, appModel.SwipeYes}, 1, liked},
+		{"NO revised to SUPER", []appModel.SwipePreference{appModel.SwipeNo, appModel.SwipeSuper}, 1, liked},
+		{"NO revised to YES, then NO", []appModel.SwipePreference{appModel.SwipeNo, appModel.SwipeYes, appModel.SwipeNo}, 1, liked},
+	}
+
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				store := backend.new(t)
+				ctx := context.Background()
+
+				swiper := newTestUser("swiper", "Male", 30, testLat, testLon)
+				swiped := newTestUser("swiped", "Female", 30, testLat, testLon)
+				createTestUsers(t, store, swiper, swiped)
+
+				now := time.Now().UTC()
+				for i, preference := range tt.swipes {
+					swipe := appModel.Swipe{SwiperId: swiper.ID, SwipedId: swiped.ID, Preference: preference, CreatedAt: now.Add(time.Duration(i) * time.Minute)}
+					matched, matchID, err := store.RecordSwipe(ctx, swipe)
+					if err != nil || matched || matchID != "" {
+						t.Fatalf("RecordSwipe(%s) = %v, %q, %v, want no match", preference, matched, matchID, err)
+					}
+				}
+
+				got, err := store.GetUserByID(ctx, swiped.ID)
+				if err != nil {
+					t.Fatalf("GetUserByID: %v", err)
+				}
+				if got.TotalSwipes != 1 || got.YesSwipes != tt.wantYes || got.Rating != tt.wantRating {
+					t.Errorf("TotalSwipes, YesSwipes, Rating = %d, %d, %g, want 1, %d, %g", got.TotalSwipes, got.YesSwipes, got.Rating, tt.wantYes, tt.wantRating)
+				}
+			})
+		}
+	}
+}
+
+// TestRecordSwipeMatch checks that the like completing a pair's likes
+// reports their match, and that repeat swipes report the same one.
+func TestRecordSwipeMatch(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	tests := []struct {
+		name   string
+		first  []appModel.SwipePreference
+		second []appModel.SwipePreference
+	}{
+		{"YES back", []appModel.SwipePreference{appModel.SwipeYes}, []appModel.SwipePreference{appModel.SwipeYes}},
+		{"SUPER back", []appModel.SwipePreference{appModel.SwipeYes}, []appModel.SwipePreference{appModel.SwipeSuper}},
+		{"NO revised to YES", []appModel.SwipePreference{appModel.SwipeYes}, []appModel.SwipePreference{appModel.SwipeNo, appModel.SwipeYes}},
+	}
+
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				store := backend.new(t)
+				ctx := context.Background()
+
+				first := newTestUser("first", "Male", 30, testLat, testLon)
+				second := newTestUser("second", "Female", 30, testLat, testLon)
+				createTestUsers(t, store, first, second)
+
+				now := time.Now().UTC()
+				swipe := func(swiper, swiped appModel.User, preference appModel.SwipePreference) (bool, string) {
+					t.Helper()
+					now = now.Add(time.Minute)
+					matched, matchID, err := store.RecordSwipe(ctx, appModel.Swipe{SwiperId: swiper.ID, SwipedId: swiped.ID, Preference: preference, CreatedAt: now})
+					if err != nil {
+						t.Fatalf("RecordSwipe(%s on %s): %v", preference, swiped.Name, err)
+					}
+					return matched, matchID
+				}
+
+				for _, preference := range tt.first {
+					if matched, matchID := swipe(first, second, preference); matched || matchID != "" {
+						t.Fatalf("first swipe = %v, %q, want no match", matched, matchID)
+					}
+				}
+				var matched bool
+				var matchID string
+				for _, preference := range tt.second {
+					matched, matchID = swipe(second, first, preference)
+				}
+				if !matched || matchID == "" {
+					t.Fatalf("completing swipe = %v, %q, want a match", matched, matchID)
+				}
+
+				for _, repeat := range []struct {
+					swiper, swiped appModel.User
+				}{{first, second}, {second, first}} {
+					if gotMatched, gotID := swipe(repeat.swiper, repeat.swiped, appModel.SwipeYes); !gotMatched || gotID != matchID {
+						t.Errorf("repeat swipe by %s = %v, %q, want %q", repeat.swiper.Name, gotMatched, gotID, matchID)
+					}
+				}
+
+				for _, user := range []appModel.User{first, second} {
+					page, err := store.ListMatches(ctx, user.ID, ListMatchesOptions{Limit: 10})
+					if err != nil {
+						t.Fatalf("ListMatches: %v", err)
+					}
+					// The match is new to the user who did not complete it
+					if len(page.Matches) != 1 || page.Matches[0].ID != matchID || page.Matches[0].Unread != (user.ID == first.ID) {
+						t.Errorf("matches of %s = %+v, want %s, unread only for first", user.Name, page.Matches, matchID)
+					}
+				}
+
+				got, err := store.GetUserByID(ctx, first.ID)
+				if err != nil {
+					t.Fatalf("GetUserByID: %v", err)
+				}
+				if got.TotalSwipes != 1 || got.YesSwipes != 1 {
+					t.Errorf("TotalSwipes, YesSwipes of first = %d, %d, want 1, 1", got.TotalSwipes, got.YesSwipes)
+				}
+			})
+		}
+	}
+}
+
+// TestSwipeResults checks that the first unexpired result stored under a
+// key is the one kept.
+func TestSwipeResults(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+			ctx := context.Background()
+
+			now := time.Now().UTC().Truncate(time.Second)
+			original := SwipeResult{SwipedId: "swiped", Preference: appModel.SwipeYes, Matched: true, MatchId: "match", CreatedAt: now}
+			get := func(userID, key string) (SwipeResult, bool) {
+				t.Helper()
+				result, ok, err := store.GetSwipeResult(ctx, userID, key)
+				if err != nil {
+					t.Fatalf("GetSwipeResult: %v", err)
+				}
+				return result, ok
+			}
+			put := func(key string, result SwipeResult) {
+				t.Helper()
+				if err := store.PutSwipeResult(ctx, "swiper", key, result); err != nil {
+					t.Fatalf("PutSwipeResult: %v", err)
+				}
+			}
+			same := func(got, want SwipeResult) bool {
+				return got.SwipedId == want.SwipedId && got.Preference == want.Preference && got.Matched == want.Matched &&
+					got.MatchId == want.MatchId && got.CreatedAt.Equal(want.CreatedAt)
+			}
+
+			put("key", original)
+			put("key", SwipeResult{SwipedId: "other", Preference: appModel.SwipeNo, CreatedAt: now})
+			if got, ok := get("swiper", "key"); !ok || !same(got, original) {
+				t.Errorf("result = %+v, %v, want the original %+v", got, ok, original)
+			}
+			if got, ok := get("other", "key"); ok {
+				t.Errorf("result of another user = %+v, want none", got)
+			}
+
+			expired := SwipeResult{SwipedId: "swiped", Preference: appModel.SwipeNo, CreatedAt: now.Add(-IdempotencyKeyTTL - time.Hour)}
+			put("expired", expired)
+			if got, ok := get("swiper", "expired"); ok {
+				t.Errorf("expired result = %+v, want none", got)
+			}
+			put("expired", original)
+			if got, ok := get("swiper", "expired"); !ok || !same(got, original) {
+				t.Errorf("result stored over an expired one = %+v, %v, want %+v", got, ok, original)
+			}
+		})
+	}
+}
+
+// TestEndMatch checks that an ended match is hidden from both users and
+// that neither can swipe on the other again.
+func TestEndMatch(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.new(t)
+			ctx := context.Background()
+
+			first := newTestUser("first", "Male", 30, testLat, testLon)
+			second := newTestUser("second", "Female", 30, testLat, testLon)
+			outsider := newTestUser("outsider", "Female", 30, testLat, testLon)
+			createTestUsers(t, store, first, second, outsider)
+
+			now := time.Now().UTC()
+			if _, _, err := store.RecordSwipe(ctx, appModel.Swipe{SwiperId: first.ID, SwipedId: second.ID, Preference: appModel.SwipeYes, CreatedAt: now}); err != nil {
+				t.Fatalf("RecordSwipe: %v", err)
+			}
+			_, matchID, err := store.RecordSwipe(ctx, appModel.Swipe{SwiperId: second.ID, SwipedId: first.ID, Preference: appModel.SwipeYes, CreatedAt: now})
+			if err != nil || matchID == "" {
+				t.Fatalf("RecordSwipe = %q, %v, want a match", matchID, err)
+			}
+
+			if err := store.EndMatch(ctx, outsider.ID, matchID); !errors.Is(err, ErrMatchNotFound) {
+				t.Errorf("EndMatch by an outsider = %v, want %v", err, ErrMatchNotFound)
+			}
+			if err := store.EndMatch(ctx, first.ID, matchID); err != nil {
+				t.Fatalf("EndMatch: %v", err)
+			}
+			if err := store.EndMatch(ctx, second.ID, matchID); !errors.Is(err, ErrMatchNotFound) {
+				t.Errorf("EndMatch of an ended match = %v, want %v", err, ErrMatchNotFound)
+			}
+
+			for _, user := range []appModel.User{first, second} {
+				page, err := store.ListMatches(ctx, user.ID, ListMatchesOptions{Limit: 10})
+				if err != nil {
+					t.Fatalf("ListMatches: %v", err)
+				}
+				if len(page.Matches) != 0 {
+					t.Errorf("matches of %s = %+v, want none", user.Name, page.Matches)
+				}
+			}
+
+			for _, swipe := range []appModel.Swipe{
+				{SwiperId: first.ID, SwipedId: second.ID, Preference: appModel.SwipeYes, CreatedAt: now},
+				{SwiperId: second.ID, SwipedId: first.ID, Preference: appModel.SwipeSuper, CreatedAt: now},
+			} {
+				if matched, matchID, err := store.RecordSwipe(ctx, swipe); !errors.Is(err, ErrUnmatched) {
+					t.Errorf("RecordSwipe(%s) after unmatching = %v, %q, %v, want %v", swipe.Preference, matched, matchID, err, ErrUnmatched)
+				}
+			}
+			for _, user := range []appModel.User{first, second} {
+				got, err := store.GetUserByID(ctx, user.ID)
+				if err != nil {
+					t.Fatalf("GetUserByID: %v", err)
+				}
+				if got.TotalSwipes != 1 || got.YesSwipes != 1 {
+					t.Errorf("TotalSwipes, YesSwipes of %s = %d, %d, want 1, 1", user.Name, got.TotalSwipes, got.YesSwipes)
+				}
+			}
+		})
+	}
+}
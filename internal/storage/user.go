@@ -2,23 +2,30 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
+	"dating-app-backend/internal/geo"
 	appModel "dating-app-backend/internal/model"
-	"errors"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/jftuga/geodist"
 )
 
-const usersTableName = "UsersTable"
+const (
+	usersTableName   = "UsersTable"
+	geohashIndexName = "GeohashIndex"
+	// discoveryCellBatch is how many geohash cells are queried concurrently.
+	discoveryCellBatch = 8
+)
 
 func (db *DynamoDB) CreateUser(ctx context.Context, user appModel.User) error {
+	user.UpdateGeohash()
 	av, err := attributevalue.MarshalMap(user)
 	if err != nil {
 		db.logger.Error("Failed to marshal user", "error", err, "userId", user.ID)
@@ -55,7 +62,7 @@ func (db *DynamoDB) GetUserByEmail(ctx context.Context, email string) (*appModel
 	}
 
 	if len(result.Items) == 0 {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 
 	var user appModel.User
@@ -68,95 +75,151 @@ func (db *DynamoDB) GetUserByEmail(ctx context.Context, email string) (*appModel
 	return &user, nil
 }
 
-func (db *DynamoDB) DiscoverUsers(ctx context.Context, currentUser appModel.User, limit int32, minAge, maxAge int, gender string, sortBy string) ([]appModel.UserPublicData, error) {
-	db.logger.Info("Discovering users", "currentUserID", currentUser.ID, "limit", limit, "minAge", minAge, "maxAge", maxAge, "gender", gender)
+func (db *DynamoDB) DiscoverUsers(ctx context.Context, currentUser appModel.User, opts DiscoverOptions) (DiscoverPage, error) {
+	db.logger.Info("Discovering users", "currentUserID", currentUser.ID, "limit", opts.Limit, "minAge", opts.MinAge, "maxAge", opts.MaxAge, "genders", opts.Genders, "maxDistanceKm", opts.MaxDistanceKm)
 
-	// Get all swipes by the current user
-	swipedUsers, err := db.getSwipedUsers(ctx, currentUser.ID)
+	// Get all swipes by the current user. They are excluded after fetching:
+	// one FilterExpression clause per swiped user would outgrow DynamoDB's
+	// expression size limit after a few hundred swipes.
+	seen, err := db.getSwipedUsers(ctx, currentUser.ID)
 	if err != nil {
 		db.logger.Error("Failed to get swiped users", "error", err, "currentUserID", currentUser.ID)
-		return nil, err
+		return DiscoverPage{}, err
 	}
 
 	// Prepare the filter expression
-	filterExp := "ID <> :currentUserId"
+	filterExp := "ID <> :currentUserId AND (attribute_not_exists(Preferences.ShowMe) OR Preferences.ShowMe = :showMe)" +
+		" AND (attribute_not_exists(Deactivated) OR Deactivated = :deactivated)"
 	expAttrValues := map[string]types.AttributeValue{
 		":currentUserId": &types.AttributeValueMemberS{Value: currentUser.ID},
+		":showMe":        &types.AttributeValueMemberBOOL{Value: true},
+		":deactivated":   &types.AttributeValueMemberBOOL{Value: false},
 	}
 
-	// Add swiped users to the filter expression
-	for i, swipedID := range swipedUsers {
-		filterExp += fmt.Sprintf(" AND ID <> :swipedId%d", i)
-		expAttrValues[fmt.Sprintf(":swipedId%d", i)] = &types.AttributeValueMemberS{Value: swipedID}
-	}
-
-	if minAge > 0 {
+	if opts.MinAge > 0 {
 		filterExp += " AND Age >= :minAge"
-		expAttrValues[":minAge"] = &types.AttributeValueMemberN{Value: strconv.Itoa(minAge)}
+		expAttrValues[":minAge"] = &types.AttributeValueMemberN{Value: strconv.Itoa(opts.MinAge)}
 	}
 
-	if maxAge > 0 {
+	if opts.MaxAge > 0 {
 		filterExp += " AND Age <= :maxAge"
-		expAttrValues[":maxAge"] = &types.AttributeValueMemberN{Value: strconv.Itoa(maxAge)}
+		expAttrValues[":maxAge"] = &types.AttributeValueMemberN{Value: strconv.Itoa(opts.MaxAge)}
 	}
 
-	if gender != "" {
-		filterExp += " AND Gender = :gender"
-		expAttrValues[":gender"] = &types.AttributeValueMemberS{Value: gender}
+	if len(opts.Genders) > 0 {
+		placeholders := make([]string, len(opts.Genders))
+		for i, gender := range opts.Genders {
+			placeholders[i] = fmt.Sprintf(":gender%d", i)
+			expAttrValues[placeholders[i]] = &types.AttributeValueMemberS{Value: gender}
+		}
+		filterExp += " AND Gender IN (" + strings.Join(placeholders, ", ") + ")"
 	}
 
-	// Perform the scan operation
-	result, err := db.client.Scan(ctx, &dynamodb.ScanInput{
-		TableName:                 aws.String(usersTableName),
-		FilterExpression:          aws.String(filterExp),
-		ExpressionAttributeValues: expAttrValues,
-		Limit:                     aws.Int32(limit),
-	})
+	radiusKm := searchRadiusKm(opts, db.radiusKm)
+
+	// Query the geohash cells around the user, nearest first, until the
+	// candidates we hold are closer than anything the next cells could contain.
+	cells := geo.CellsWithin(currentUser.Latitude, currentUser.Longitude, radiusKm)
+	page, err := discover(ctx, currentUser, opts, func(after *DistanceKey, n int) ([]appModel.User, error) {
+		var users []appModel.User
+		for start := 0; start < len(cells); start += discoveryCellBatch {
+			batch := cells[start:min(start+discoveryCellBatch, len(cells))]
+
+			if len(users) >= n {
+				users = nearestUsers(currentUser, users, n)
+				if distanceKm(currentUser, users[len(users)-1]) <= batch[0].MinDistanceKm {
+					break
+				}
+			}
+
+			found, err := db.queryCells(ctx, batch, filterExp, expAttrValues)
+			if err != nil {
+				return nil, err
+			}
+			for _, user := range found {
+				if !seen.Has(user.ID) && distanceKm(currentUser, user) <= radiusKm && acceptsCurrentUser(currentUser, user) && isAfter(currentUser, user, after) {
+					users = append(users, user)
+				}
+			}
+		}
+		return nearestUsers(currentUser, users, n), nil
+	}, db)
 	if err != nil {
-		db.logger.Error("Failed to scan users for discovery", "error", err, "currentUserID", currentUser.ID)
-		return nil, err
+		db.logger.Error("Failed to query users for discovery", "error", err, "currentUserID", currentUser.ID)
+		return DiscoverPage{}, err
 	}
 
-	var users []appModel.User
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &users)
-	if err != nil {
-		db.logger.Error("Failed to unmarshal discovered users", "error", err, "currentUserID", currentUser.ID)
-		return nil, err
+	db.logger.Info("Users discovered successfully", "currentUserID", currentUser.ID, "count", len(page.Results))
+	return page, nil
+}
+
+// queryCells queries the GeohashIndex for every cell concurrently and returns
+// the users that pass filterExp.
+func (db *DynamoDB) queryCells(ctx context.Context, cells []geo.NearbyCell, filterExp string, expAttrValues map[string]types.AttributeValue) ([]appModel.User, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		users    []appModel.User
+		firstErr error
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
 	}
 
-	publicUsers := make([]appModel.UserPublicData, len(users))
-	for i, user := range users {
-		publicData := user.PublicData()
-		distance, _ := geodist.HaversineDistance(geodist.Coord{Lat: currentUser.Latitude, Lon: currentUser.Longitude},
-			geodist.Coord{Lat: user.Latitude, Lon: user.Longitude})
-		publicData.DistanceFromMe = distance
-		publicUsers[i] = publicData
-	}
-
-	// TODO: break out and write a test for this ⤵️
-	switch sortBy {
-	case "distance":
-		sort.Slice(publicUsers, func(i, j int) bool {
-			return publicUsers[i].DistanceFromMe < publicUsers[j].DistanceFromMe
-		})
-	case "attractiveness":
-		sort.Slice(publicUsers, func(i, j int) bool {
-			return publicUsers[i].AttractivenessScore > publicUsers[j].AttractivenessScore
-		})
-	default: // Combined sorting
-		sort.Slice(publicUsers, func(i, j int) bool {
-			scoreI := publicUsers[i].AttractivenessScore / (publicUsers[i].DistanceFromMe + 1)
-			scoreJ := publicUsers[j].AttractivenessScore / (publicUsers[j].DistanceFromMe + 1)
-			return scoreI > scoreJ
-		})
-	}
-
-	db.logger.Info("Users discovered successfully", "currentUserID", currentUser.ID, "count", len(publicUsers))
-	return publicUsers, nil
+	for _, cell := range cells {
+		values := make(map[string]types.AttributeValue, len(expAttrValues)+1)
+		for k, v := range expAttrValues {
+			values[k] = v
+		}
+		values[":cell"] = &types.AttributeValueMemberS{Value: cell.Cell}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			paginator := dynamodb.NewQueryPaginator(db.client, &dynamodb.QueryInput{
+				TableName:                 aws.String(usersTableName),
+				IndexName:                 aws.String(geohashIndexName),
+				KeyConditionExpression:    aws.String("Geohash = :cell"),
+				FilterExpression:          aws.String(filterExp),
+				ExpressionAttributeValues: values,
+			})
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(ctx)
+				if err != nil {
+					setErr(err)
+					return
+				}
+
+				var found []appModel.User
+				if err := attributevalue.UnmarshalListOfMaps(page.Items, &found); err != nil {
+					setErr(err)
+					return
+				}
+
+				mu.Lock()
+				users = append(users, found...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return users, firstErr
 }
 
-func (db *DynamoDB) getSwipedUsers(ctx context.Context, swiperId string) ([]string, error) {
-	result, err := db.client.Query(ctx, &dynamodb.QueryInput{
+// getSwipedUsers returns the set of users swiperId has swiped on, reading
+// every page of the swiper's swipes on a cache miss.
+func (db *DynamoDB) getSwipedUsers(ctx context.Context, swiperId string) (*seenSet, error) {
+	if seen, ok := db.seen.get(swiperId); ok {
+		return seen, nil
+	}
+
+	paginator := dynamodb.NewQueryPaginator(db.client, &dynamodb.QueryInput{
 		TableName:              aws.String(swipesTableName),
 		KeyConditionExpression: aws.String("SwiperId = :swiperId"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
@@ -164,27 +227,38 @@ func (db *DynamoDB) getSwipedUsers(ctx context.Context, swiperId string) ([]stri
 		},
 		ProjectionExpression: aws.String("SwipedId"),
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	var swipes []struct {
-		SwipedId string `dynamodbav:"SwipedId"`
-	}
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &swipes)
-	if err != nil {
-		return nil, err
-	}
 
-	swipedIds := make([]string, len(swipes))
-	for i, swipe := range swipes {
-		swipedIds[i] = swipe.SwipedId
+	var swipedIds []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var swipes []struct {
+			SwipedId string `dynamodbav:"SwipedId"`
+		}
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &swipes); err != nil {
+			return nil, err
+		}
+
+		for _, swipe := range swipes {
+			swipedIds = append(swipedIds, swipe.SwipedId)
+		}
 	}
 
-	return swipedIds, nil
+	seen := newSeenSet(swipedIds)
+	db.seen.put(swiperId, seen)
+	return seen, nil
 }
 
 func (db *DynamoDB) GetUserByID(ctx context.Context, userID string) (*appModel.User, error) {
+	return db.getUser(ctx, userID, false)
+}
+
+// getUser is GetUserByID, with a strongly consistent read if consistent is
+// set.
+func (db *DynamoDB) getUser(ctx context.Context, userID string, consistent bool) (*appModel.User, error) {
 	db.logger.Info("Getting user by ID", "userID", userID)
 
 	result, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
@@ -192,6 +266,7 @@ func (db *DynamoDB) GetUserByID(ctx context.Context, userID string) (*appModel.U
 		Key: map[string]types.AttributeValue{
 			"ID": &types.AttributeValueMemberS{Value: userID},
 		},
+		ConsistentRead: aws.Bool(consistent),
 	})
 	if err != nil {
 		db.logger.Error("Failed to get user from DynamoDB", "error", err, "userID", userID)
@@ -200,7 +275,7 @@ func (db *DynamoDB) GetUserByID(ctx context.Context, userID string) (*appModel.U
 
 	if result.Item == nil {
 		db.logger.Warn("User not found", "userID", userID)
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrUserNotFound
 	}
 
 	var user appModel.User
@@ -215,6 +290,7 @@ func (db *DynamoDB) GetUserByID(ctx context.Context, userID string) (*appModel.U
 }
 
 func (db *DynamoDB) UpdateUser(ctx context.Context, user *appModel.User) error {
+	user.UpdateGeohash()
 	item, err := attributevalue.MarshalMap(user)
 	if err != nil {
 		db.logger.Error("Failed to marshal user", "error", err, "userId", user.ID)
@@ -232,3 +308,122 @@ func (db *DynamoDB) UpdateUser(ctx context.Context, user *appModel.User) error {
 
 	return nil
 }
+
+func (db *DynamoDB) UpdatePreferences(ctx context.Context, userID string, prefs appModel.DiscoveryPreferences) error {
+	preferences, err := attributevalue.Marshal(prefs)
+	if err != nil {
+		db.logger.Error("Failed to marshal preferences", "error", err, "userId", userID)
+		return err
+	}
+	return db.setUserAttribute(ctx, userID, "Preferences", preferences)
+}
+
+func (db *DynamoDB) SetDeactivated(ctx context.Context, userID string, deactivated bool) error {
+	return db.setUserAttribute(ctx, userID, "Deactivated", &types.AttributeValueMemberBOOL{Value: deactivated})
+}
+
+// setUserAttribute sets one top-level attribute of an existing user,
+// leaving the others, such as the swipe counters, as they are.
+func (db *DynamoDB) setUserAttribute(ctx context.Context, userID, name string, value types.AttributeValue) error {
+	_, err := db.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(usersTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: userID},
+		},
+		UpdateExpression:         aws.String("SET #name = :value"),
+		ConditionExpression:      aws.String("attribute_exists(ID)"),
+		ExpressionAttributeNames: map[string]string{"#name": name},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":value": value,
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		db.logger.Error("Failed to update user in DynamoDB", "error", err, "userId", userID, "attribute", name)
+		return err
+	}
+	return nil
+}
+
+func (db *DynamoDB) ScanUsers(ctx context.Context, fn func(users []appModel.User) error) error {
+	paginator := dynamodb.NewScanPaginator(db.client, &dynamodb.ScanInput{
+		TableName: aws.String(usersTableName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			db.logger.Error("Failed to scan users", "error", err)
+			return err
+		}
+		if len(page.Items) == 0 {
+			continue
+		}
+
+		var users []appModel.User
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &users); err != nil {
+			db.logger.Error("Failed to unmarshal scanned users", "error", err)
+			return err
+		}
+		if err := fn(users); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateGeohash stores user.Geohash, for users stored before discovery
+// indexed them by cell. It writes nothing and returns false if the stored
+// location no longer matches user's, because the user has moved and
+// UpdateUser has stored their new cell already.
+func (db *DynamoDB) UpdateGeohash(ctx context.Context, user appModel.User) (bool, error) {
+	_, err := db.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(usersTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: user.ID},
+		},
+		UpdateExpression:    aws.String("SET Geohash = :geohash"),
+		ConditionExpression: aws.String("Latitude = :latitude AND Longitude = :longitude"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":geohash":   &types.AttributeValueMemberS{Value: user.Geohash},
+			":latitude":  &types.AttributeValueMemberN{Value: strconv.FormatFloat(user.Latitude, 'f', -1, 64)},
+			":longitude": &types.AttributeValueMemberN{Value: strconv.FormatFloat(user.Longitude, 'f', -1, 64)},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		db.logger.Error("Failed to update geohash in DynamoDB", "error", err, "userId", user.ID)
+		return false, err
+	}
+	return true, nil
+}
+
+func (db *DynamoDB) UpdateAttractivenessScore(ctx context.Context, user appModel.User) (bool, error) {
+	_, err := db.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(usersTableName),
+		Key: map[string]types.AttributeValue{
+			"ID": &types.AttributeValueMemberS{Value: user.ID},
+		},
+		UpdateExpression:    aws.String("SET AttractivenessScore = :score"),
+		ConditionExpression: aws.String("YesSwipes = :yesSwipes AND TotalSwipes = :totalSwipes"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":score":       &types.AttributeValueMemberN{Value: strconv.FormatFloat(user.AttractivenessScore, 'f', -1, 64)},
+			":yesSwipes":   &types.AttributeValueMemberN{Value: strconv.Itoa(user.YesSwipes)},
+			":totalSwipes": &types.AttributeValueMemberN{Value: strconv.Itoa(user.TotalSwipes)},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		db.logger.Error("Failed to update attractiveness score in DynamoDB", "error", err, "userId", user.ID)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appModel "dating-app-backend/internal/model"
+)
+
+// TestUserUpdatesKeepSwipes checks that changing a user's preferences or
+// deactivating them does not undo a swipe counted since they were read.
+func TestUserUpdatesKeepSwipes(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Storage
+	}{
+		{"memory", func(t *testing.T) Storage { return NewMemory(testConfig(), testLogger()) }},
+		{"sqlite", func(t *testing.T) Storage { return newTestSQLite(t) }},
+	}
+	showMe := false
+	updates := []struct {
+		name   string
+		update func(store Storage, userID string) error
+		check  func(user *appModel.User) bool
+	}{
+		{
+			name: "preferences",
+			update: func(store Storage, userID string) error {
+				return store.UpdatePreferences(context.Background(), userID, appModel.DiscoveryPreferences{MinAge: 25, MaxAge: 40, Genders: []string{}, ShowMe: &showMe})
+			},
+			check: func(user *appModel.User) bool {
+				return user.Preferences.MinAge == 25 && user.Preferences.MaxAge == 40 && !user.Preferences.Visible()
+			},
+		},
+		{
+			name: "deactivated",
+			update: func(store Storage, userID string) error {
+				return store.SetDeactivated(context.Background(), userID, true)
+			},
+			check: func(user *appModel.User) bool { return user.Deactivated },
+		},
+	}
+
+	for _, backend := range backends {
+		for _, tt := range updates {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				store := backend.new(t)
+				ctx := context.Background()
+
+				swiper := newTestUser("swiper", "Male", 30, testLat, testLon)
+				swiped := newTestUser("swiped", "Female", 30, testLat, testLon)
+				createTestUsers(t, store, swiper, swiped)
+
+				if _, _, err := store.RecordSwipe(ctx, appModel.Swipe{SwiperId: swiper.ID, SwipedId: swiped.ID, Preference: appModel.SwipeYes, CreatedAt: time.Now().UTC()}); err != nil {
+					t.Fatalf("RecordSwipe: %v", err)
+				}
+				if err := tt.update(store, swiped.ID); err != nil {
+					t.Fatalf("update: %v", err)
+				}
+
+				got, err := store.GetUserByID(ctx, swiped.ID)
+				if err != nil {
+					t.Fatalf("GetUserByID: %v", err)
+				}
+				if !tt.check(got) {
+					t.Errorf("user = %+v, want the update applied", got)
+				}
+				if got.TotalSwipes != 1 || got.YesSwipes != 1 || got.Rating <= appModel.InitialRating {
+					t.Errorf("TotalSwipes, YesSwipes, Rating = %d, %d, %g after the update, want the swipe kept", got.TotalSwipes, got.YesSwipes, got.Rating)
+				}
+
+				if err := tt.update(store, "missing"); !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("update of a missing user = %v, want %v", err, ErrUserNotFound)
+				}
+			})
+		}
+	}
+}
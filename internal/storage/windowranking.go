@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const windowRankingsTableName = "WindowRankingsTable"
+
+// windowRankingItem is the ranking of a discovery window, stored under the
+// user it was ranked for. DynamoDB deletes it some time after ExpiresAt, a
+// Unix time in seconds.
+type windowRankingItem struct {
+	UserId       string    `dynamodbav:"UserId"`
+	RankingId    string    `dynamodbav:"RankingId"`
+	CandidateIds []string  `dynamodbav:"CandidateIds"`
+	CreatedAt    time.Time `dynamodbav:"CreatedAt"`
+	ExpiresAt    int64     `dynamodbav:"ExpiresAt"`
+}
+
+func (db *DynamoDB) createWindowRankingsTable() error {
+	_, err := db.client.CreateTable(context.TODO(), &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("UserId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("RankingId"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("UserId"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("RankingId"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		TableName:   aws.String(windowRankingsTableName),
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var resourceInUseErr *types.ResourceInUseException
+		if errors.As(err, &resourceInUseErr) {
+			db.logger.Warn("WindowRankings table already exists")
+			return nil
+		}
+		db.logger.Error("Failed to create WindowRankings table", "error", err)
+		return err
+	}
+
+	if err := db.enableTimeToLive(windowRankingsTableName); err != nil {
+		db.logger.Error("Failed to enable time to live on WindowRankings table", "error", err)
+		return err
+	}
+
+	db.logger.Info("Successfully created WindowRankings table")
+	return nil
+}
+
+func (db *DynamoDB) putWindowRanking(ctx context.Context, userID, rankingID string, ids []string) error {
+	now := time.Now().UTC()
+	item, err := attributevalue.MarshalMap(windowRankingItem{
+		UserId:       userID,
+		RankingId:    rankingID,
+		CandidateIds: ids,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(WindowRankingTTL).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(windowRankingsTableName),
+		Item:      item,
+	})
+	if err != nil {
+		db.logger.Error("Failed to put window ranking", "error", err, "userId", userID)
+		return err
+	}
+	return nil
+}
+
+func (db *DynamoDB) getWindowRanking(ctx context.Context, userID, rankingID string) ([]string, error) {
+	result, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(windowRankingsTableName),
+		Key: map[string]types.AttributeValue{
+			"UserId":    &types.AttributeValueMemberS{Value: userID},
+			"RankingId": &types.AttributeValueMemberS{Value: rankingID},
+		},
+	})
+	if err != nil {
+		db.logger.Error("Failed to get window ranking", "error", err, "userId", userID)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, ErrRankingExpired
+	}
+
+	var item windowRankingItem
+	if err := attributevalue.UnmarshalMap(result.Item, &item); err != nil {
+		db.logger.Error("Failed to unmarshal window ranking", "error", err, "userId", userID)
+		return nil, err
+	}
+
+	// Expired items linger until DynamoDB gets round to deleting them
+	if time.Since(item.CreatedAt) > WindowRankingTTL {
+		return nil, ErrRankingExpired
+	}
+	return item.CandidateIds, nil
+}